@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/format"
+	"github.com/jalapeno/config-pub/internal/ingest"
+)
+
+const (
+	defaultIGPCollection = "igp_node"
+	defaultBGPCollection = "bgp_node"
+)
+
+// options are the validated settings config-ingest runs with.
+type options struct {
+	cfg      *config.IngestConfig
+	keys     []string
+	matchers []ingest.Matcher
+	schemas  *format.Decoder
+}
+
+func (o *options) arango() ingest.ArangoConfig {
+	arango := ingest.ArangoConfigFrom(o.cfg.Arango.ArangoConfig)
+	arango.Matchers = o.matchers
+	arango.Bootstrap = o.cfg.Arango.Bootstrap
+	arango.Wait = o.cfg.Arango.Wait
+	arango.History = o.cfg.Arango.HistoryCollection
+	arango.HistoryVersions = o.cfg.Retention.History
+	return arango
+}
+
+// flagValues holds the command line flags until they are applied over the
+// config file and environment.
+type flagValues struct {
+	configPath string
+
+	kafkaBrokers    string
+	kafkaTopic      string
+	kafkaGroup      string
+	startOffset     string
+	deadLetterTopic string
+	maxMessageSize  int
+	schemaRegistry  string
+	schemaIDs       string
+
+	dbURL      string
+	dbName     string
+	dbUser     string
+	dbPass     string
+	dbUserFile string
+	dbPassFile string
+	dbAuth     string
+	dbToken    string
+	dbCAFile   string
+	dbCertFile string
+	dbKeyFile  string
+	dbInsecure bool
+	dbTimeout  time.Duration
+	dbWait     time.Duration
+	bootstrap  bool
+
+	igpCollection string
+	bgpCollection string
+	collections   string
+	matchKeys     string
+	chunkTimeout  time.Duration
+
+	historyCollection string
+	historyVersions   int
+}
+
+func bindFlags(fs *flag.FlagSet) *flagValues {
+	def := config.DefaultIngest()
+	v := &flagValues{}
+	fs.StringVar(&v.configPath, "config", os.Getenv(config.IngestEnvPrefix+"CONFIG"), "Path to config file (optional)")
+	fs.StringVar(&v.kafkaBrokers, "message-server", "", "Kafka broker list (comma-separated)")
+	fs.StringVar(&v.kafkaTopic, "kafka-topic", strings.Join(def.Kafka.Topics, ","), "Kafka topics to consume (comma-separated)")
+	fs.StringVar(&v.kafkaGroup, "kafka-group", def.Kafka.Group, "Kafka consumer group id")
+	fs.StringVar(&v.startOffset, "kafka-start-offset", def.Kafka.StartOffset, "Where a new consumer group starts: first or last")
+	fs.StringVar(&v.deadLetterTopic, "dead-letter-topic", "", "Kafka topic for rejected payloads (empty to only log them)")
+	fs.StringVar(&v.schemaRegistry, "schema-registry", "", "Schema registry URL to check the schema IDs of protobuf and Avro payloads against")
+	fs.StringVar(&v.schemaIDs, "schema-ids", "", "Schema IDs accepted without the registry (comma-separated; 0 always is)")
+	fs.IntVar(&v.maxMessageSize, "kafka-max-message-size", def.Kafka.MaxMessageSize, "Largest message the brokers accept; larger rejected payloads are dead-lettered in chunks")
+	fs.StringVar(&v.dbURL, "database-server", "", "ArangoDB endpoint, e.g. http://arangodb.jalapeno:8529; several coordinators comma-separated for failover")
+	fs.StringVar(&v.dbName, "database-name", "", "ArangoDB database name")
+	fs.StringVar(&v.dbUser, "database-user", "", "ArangoDB username")
+	fs.StringVar(&v.dbPass, "database-pass", "", "ArangoDB password")
+	fs.StringVar(&v.dbUserFile, "database-user-file", "", "Path to ArangoDB username file")
+	fs.StringVar(&v.dbPassFile, "database-pass-file", "", "Path to ArangoDB password file")
+	fs.StringVar(&v.dbAuth, "database-auth", "", "ArangoDB authentication: basic, jwt, token or none (default basic, token when a token file is set)")
+	fs.StringVar(&v.dbToken, "database-token-file", "", "Path to an ArangoDB JWT, re-read on reconnect")
+	fs.StringVar(&v.dbCAFile, "database-ca-file", "", "CA bundle to verify the ArangoDB server certificate")
+	fs.StringVar(&v.dbCertFile, "database-cert-file", "", "Client certificate for ArangoDB")
+	fs.StringVar(&v.dbKeyFile, "database-key-file", "", "Client certificate key for ArangoDB")
+	fs.BoolVar(&v.dbInsecure, "database-insecure-skip-verify", false, "Skip ArangoDB server certificate verification")
+	fs.DurationVar(&v.dbTimeout, "database-timeout", def.Arango.Timeout, "Timeout for connecting to ArangoDB and for each request")
+	fs.DurationVar(&v.dbWait, "database-wait", def.Arango.Wait, "Retry this long while ArangoDB or the database is unavailable (0 to fail at once)")
+	fs.BoolVar(&v.bootstrap, "bootstrap", false, "Create missing collections and match indexes at startup")
+	fs.StringVar(&v.igpCollection, "igp-collection", defaultIGPCollection, "Arango IGP node collection")
+	fs.StringVar(&v.bgpCollection, "bgp-collection", defaultBGPCollection, "Arango BGP node collection")
+	fs.StringVar(&v.collections, "collections", "", "Collections to update as collection[:kind] (igp, bgp, peer, node), comma-separated; defaults to the IGP and BGP collections")
+	fs.StringVar(&v.matchKeys, "match-keys", strings.Join(ingest.MatchKeys, ","), "Node match keys in priority order (comma-separated)")
+	fs.DurationVar(&v.chunkTimeout, "chunk-timeout", def.Retention.Chunks, "Drop incomplete chunked messages after this long")
+	fs.StringVar(&v.historyCollection, "history-collection", def.Arango.HistoryCollection, "Arango collection keeping past configs per target (empty for none)")
+	fs.IntVar(&v.historyVersions, "history-versions", def.Retention.History, "Config versions kept per target (0 for all)")
+	return v
+}
+
+// load reads the config file named by -config or CONFIG_INGEST_CONFIG,
+// applies CONFIG_INGEST_* variables over it and the flags given on the
+// parsed command line over those, and validates the result, reporting every
+// error. Without Kafka, as when replaying files, its settings are not
+// checked.
+func (v *flagValues) load(fs *flag.FlagSet, withKafka bool) (*options, error) {
+	cfg, err := config.LoadIngest(v.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only flags given on the command line override the file and environment.
+	setFlags := map[string]func(){
+		"message-server":         func() { cfg.Kafka.Brokers = config.SplitList(v.kafkaBrokers) },
+		"kafka-topic":            func() { cfg.Kafka.Topics = config.SplitList(v.kafkaTopic) },
+		"kafka-group":            func() { cfg.Kafka.Group = v.kafkaGroup },
+		"kafka-start-offset":     func() { cfg.Kafka.StartOffset = v.startOffset },
+		"dead-letter-topic":      func() { cfg.Kafka.DeadLetterTopic = v.deadLetterTopic },
+		"kafka-max-message-size": func() { cfg.Kafka.MaxMessageSize = v.maxMessageSize },
+		"schema-registry":        func() { cfg.Kafka.Schemas.RegistryURL = v.schemaRegistry },
+		"database-server": func() {
+			cfg.Arango.URL, cfg.Arango.Endpoints = "", config.SplitList(v.dbURL)
+		},
+		"database-name":                 func() { cfg.Arango.Database = v.dbName },
+		"database-user":                 func() { cfg.Arango.User = v.dbUser },
+		"database-pass":                 func() { cfg.Arango.Password = v.dbPass },
+		"database-user-file":            func() { cfg.Arango.UserFile = v.dbUserFile },
+		"database-pass-file":            func() { cfg.Arango.PassFile = v.dbPassFile },
+		"database-auth":                 func() { cfg.Arango.Auth = v.dbAuth },
+		"database-token-file":           func() { cfg.Arango.TokenFile = v.dbToken },
+		"database-ca-file":              func() { cfg.Arango.TLS.CAFile = v.dbCAFile },
+		"database-cert-file":            func() { cfg.Arango.TLS.CertFile = v.dbCertFile },
+		"database-key-file":             func() { cfg.Arango.TLS.KeyFile = v.dbKeyFile },
+		"database-insecure-skip-verify": func() { cfg.Arango.TLS.InsecureSkipVerify = v.dbInsecure },
+		"database-timeout":              func() { cfg.Arango.Timeout = v.dbTimeout },
+		"database-wait":                 func() { cfg.Arango.Wait = v.dbWait },
+		"bootstrap":                     func() { cfg.Arango.Bootstrap = v.bootstrap },
+		"match-keys":                    func() { cfg.Match.Keys = config.SplitList(v.matchKeys) },
+		"chunk-timeout":                 func() { cfg.Retention.Chunks = v.chunkTimeout },
+		"history-collection":            func() { cfg.Arango.HistoryCollection = v.historyCollection },
+		"history-versions":              func() { cfg.Retention.History = v.historyVersions },
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if apply, ok := setFlags[f.Name]; ok {
+			apply()
+		}
+	})
+	switch {
+	case set["collections"]:
+		cfg.Match.Collections = config.SplitList(v.collections)
+	case set["igp-collection"] || set["bgp-collection"]:
+		cfg.Match.Collections = []string{v.igpCollection + ":" + ingest.KindIGP, v.bgpCollection + ":" + ingest.KindBGP}
+	}
+
+	errs := []error{}
+	if set["schema-ids"] {
+		ids, err := config.ParseInts(v.schemaIDs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("-schema-ids: %w", err))
+		}
+		cfg.Kafka.Schemas.IDs = ids
+	}
+	errs = append(errs, cfg.Validate(withKafka))
+	keys, err := ingest.ParseMatchKeys(cfg.Match.Keys)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("match.keys: %w", err))
+	}
+	matchers, err := ingest.ParseMatchers(cfg.Match.Collections)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("match.collections: %w", err))
+	}
+	var registry format.Registry
+	if cfg.Kafka.Schemas.RegistryURL != "" {
+		httpRegistry, err := format.NewHTTPRegistry(format.RegistryConfig{
+			URL:      cfg.Kafka.Schemas.RegistryURL,
+			Username: cfg.Kafka.Schemas.Username,
+			Password: cfg.Kafka.Schemas.Password,
+			Timeout:  cfg.Kafka.Schemas.Timeout,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("kafka.schemas: %w", err))
+		} else {
+			registry = httpRegistry
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &options{
+		cfg:      cfg,
+		keys:     keys,
+		matchers: matchers,
+		schemas:  format.NewDecoder(registry, cfg.Kafka.Schemas.IDs),
+	}, nil
+}
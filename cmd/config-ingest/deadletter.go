@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	pubkafka "github.com/jalapeno/config-pub/internal/kafka"
+	"github.com/segmentio/kafka-go"
+)
+
+const headerDeadLetterReason = "config-ingest-error"
+
+// deadLetter forwards payloads config-ingest cannot handle (unknown schema
+// major, bad encoding or hash, unparsable JSON) to a separate topic so they
+// can be inspected or replayed by a newer consumer. Payloads larger than
+// maxMsg, such as reassembled chunked messages, are chunked again; chunks
+// that never reassembled are forwarded as they are. A nil deadLetter only
+// logs.
+type deadLetter struct {
+	writer *kafka.Writer
+	maxMsg int
+}
+
+func newDeadLetter(brokers []string, topic string, maxMsg int) *deadLetter {
+	if topic == "" {
+		return nil
+	}
+	return &deadLetter{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 100 * time.Millisecond,
+		BatchBytes:   int64(maxMsg + pubkafka.BatchOverhead),
+	}, maxMsg: maxMsg}
+}
+
+func (d *deadLetter) send(ctx context.Context, key, value []byte, headers []kafka.Header, reason error) {
+	log.Printf("rejected message key=%s: %v", key, reason)
+	if d == nil {
+		return
+	}
+
+	out := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		switch h.Key {
+		case pubkafka.HeaderChunkID, pubkafka.HeaderChunkIndex, pubkafka.HeaderChunkCount, pubkafka.HeaderChunkChecksum:
+			continue
+		}
+		out = append(out, h)
+	}
+	out = append(out, kafka.Header{Key: headerDeadLetterReason, Value: []byte(reason.Error())})
+
+	now := time.Now().UTC()
+	msgs := []kafka.Message{{Key: key, Value: value, Headers: out, Time: now}}
+	if len(value) > d.maxMsg {
+		var err error
+		msgs, err = pubkafka.SplitChunks(key, value, d.maxMsg, out, now)
+		if err != nil {
+			log.Printf("dead-letter publish failed for key=%s: %v", key, err)
+			return
+		}
+	}
+	if err := d.writer.WriteMessages(ctx, msgs...); err != nil {
+		log.Printf("dead-letter publish failed for key=%s: %v", key, err)
+	}
+}
+
+// sendChunks forwards chunk messages the reassembler dropped as they were
+// received, chunk headers included, so the set can still be reassembled.
+func (d *deadLetter) sendChunks(ctx context.Context, chunkErr *pubkafka.ChunkError) {
+	log.Printf("rejected %d chunk(s): %v", len(chunkErr.Messages), chunkErr)
+	if d == nil || len(chunkErr.Messages) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	msgs := make([]kafka.Message, 0, len(chunkErr.Messages))
+	for _, m := range chunkErr.Messages {
+		headers := append(slices.Clip(m.Headers), kafka.Header{Key: headerDeadLetterReason, Value: []byte(chunkErr.Error())})
+		msgs = append(msgs, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers, Time: now})
+	}
+	if err := d.writer.WriteMessages(ctx, msgs...); err != nil {
+		log.Printf("dead-letter publish failed for chunk %s: %v", chunkErr.ID, err)
+	}
+}
+
+func (d *deadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.writer.Close()
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -11,76 +12,52 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/format"
 	"github.com/jalapeno/config-pub/internal/gnmi"
 	"github.com/jalapeno/config-pub/internal/ingest"
+	pubkafka "github.com/jalapeno/config-pub/internal/kafka"
 	"github.com/segmentio/kafka-go"
 )
 
-const (
-	defaultIGPCollection = "igp_node"
-	defaultBGPCollection = "bgp_node"
-)
-
 func main() {
-	var (
-		kafkaBrokers string
-		kafkaTopic   string
-		kafkaGroup   string
-
-		dbURL      string
-		dbName     string
-		dbUser     string
-		dbPass     string
-		dbUserFile string
-		dbPassFile string
-
-		igpCollection string
-		bgpCollection string
-	)
-
-	flag.StringVar(&kafkaBrokers, "message-server", "", "Kafka broker list (comma-separated)")
-	flag.StringVar(&kafkaTopic, "kafka-topic", "gnmi-config", "Kafka topic to consume")
-	flag.StringVar(&kafkaGroup, "kafka-group", "config-ingest", "Kafka consumer group id")
-	flag.StringVar(&dbURL, "database-server", "", "ArangoDB endpoint, e.g. http://arangodb.jalapeno:8529")
-	flag.StringVar(&dbName, "database-name", "", "ArangoDB database name")
-	flag.StringVar(&dbUser, "database-user", "", "ArangoDB username")
-	flag.StringVar(&dbPass, "database-pass", "", "ArangoDB password")
-	flag.StringVar(&dbUserFile, "database-user-file", "", "Path to ArangoDB username file")
-	flag.StringVar(&dbPassFile, "database-pass-file", "", "Path to ArangoDB password file")
-	flag.StringVar(&igpCollection, "igp-collection", defaultIGPCollection, "Arango IGP node collection")
-	flag.StringVar(&bgpCollection, "bgp-collection", defaultBGPCollection, "Arango BGP node collection")
-	flag.Parse()
-
-	if kafkaBrokers == "" || kafkaTopic == "" {
-		log.Fatal("message-server and kafka-topic are required")
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
 	}
-	if dbURL == "" || dbName == "" {
-		log.Fatal("database-server and database-name are required")
+
+	flags := bindFlags(flag.CommandLine)
+	flag.Parse()
+	opts, err := flags.load(flag.CommandLine, true)
+	if err != nil {
+		log.Fatalf("config: %v", err)
 	}
+	cfg := opts.cfg
 
-	client, err := ingest.NewArangoClient(ingest.ArangoConfig{
-		URL:           dbURL,
-		Database:      dbName,
-		User:          dbUser,
-		Password:      dbPass,
-		UserFile:      dbUserFile,
-		PassFile:      dbPassFile,
-		IGPCollection: igpCollection,
-		BGPCollection: bgpCollection,
-	})
+	client, err := ingest.NewArangoClient(opts.arango())
 	if err != nil {
 		log.Fatalf("arango client: %v", err)
 	}
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        splitComma(kafkaBrokers),
-		Topic:          kafkaTopic,
-		GroupID:        kafkaGroup,
+	readerConfig := kafka.ReaderConfig{
+		Brokers:        cfg.Kafka.Brokers,
+		GroupID:        cfg.Kafka.Group,
 		StartOffset:    kafka.FirstOffset,
-		CommitInterval: time.Second,
-	})
+		CommitInterval: cfg.Kafka.CommitInterval,
+	}
+	if len(cfg.Kafka.Topics) == 1 {
+		readerConfig.Topic = cfg.Kafka.Topics[0]
+	} else {
+		readerConfig.GroupTopics = cfg.Kafka.Topics
+	}
+	if cfg.Kafka.StartOffset == config.OffsetLast {
+		readerConfig.StartOffset = kafka.LastOffset
+	}
+	reader := kafka.NewReader(readerConfig)
 	defer reader.Close()
 
+	dlq := newDeadLetter(cfg.Kafka.Brokers, cfg.Kafka.DeadLetterTopic, cfg.Kafka.MaxMessageSize)
+	defer dlq.Close()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -92,6 +69,23 @@ func main() {
 		cancel()
 	}()
 
+	chunkTimeout := cfg.Retention.Chunks
+	reassembler := pubkafka.NewReassembler(chunkTimeout)
+	go func() {
+		ticker := time.NewTicker(chunkTimeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, chunkErr := range reassembler.Expire(now) {
+					dlq.sendChunks(ctx, chunkErr)
+				}
+			}
+		}
+	}()
+
 	for {
 		msg, err := reader.ReadMessage(ctx)
 		if err != nil {
@@ -102,68 +96,96 @@ func main() {
 			continue
 		}
 
-		var payload gnmi.ConfigMessage
-		if err := json.Unmarshal(msg.Value, &payload); err != nil {
-			log.Printf("invalid payload: %v", err)
+		value, headers, complete, err := reassembler.Add(msg)
+		var chunkErr *pubkafka.ChunkError
+		if errors.As(err, &chunkErr) {
+			dlq.sendChunks(ctx, chunkErr)
+			continue
+		}
+		if !complete {
+			continue
+		}
+		payload, err := decodePayload(ctx, opts.schemas, value, headers)
+		if err != nil {
+			dlq.send(ctx, msg.Key, value, headers, err)
 			continue
 		}
 
-		info, err := ingest.ExtractMatchInfo(payload.Updates)
+		candidates, results, err := apply(ctx, client, opts.keys, payload)
 		if err != nil {
 			log.Printf("parse payload: %v", err)
 			continue
 		}
+		log.Printf("config for target=%s: %s", payload.Target, summarize(results, candidates))
+	}
+}
 
-		update := map[string]interface{}{
-			"running_config": payload,
-			"config_ts":      payload.Timestamp,
-			"config_source": map[string]interface{}{
-				"target":  payload.Target,
-				"address": payload.Address,
-			},
-		}
+// decodePayload checks a complete message's envelope and decodes its value,
+// accepting only the schema IDs schemas knows.
+func decodePayload(ctx context.Context, schemas *format.Decoder, value []byte, headers []kafka.Header) (*gnmi.ConfigMessage, error) {
+	env, err := pubkafka.ParseEnvelope(headers)
+	if err == nil {
+		err = env.CheckVersion()
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := env.Decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	var payload gnmi.ConfigMessage
+	if err := schemas.Unmarshal(ctx, env.ContentType, decoded, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	return &payload, nil
+}
 
-		switch {
-		case info.HasISIS:
-			ok, err := client.UpdateIGP(ctx, info.RouterID, info.Hostname, update)
-			if err != nil {
-				log.Printf("igp update failed for %s: %v", info.RouterID, err)
-				continue
-			}
-			if !ok {
-				log.Printf("igp node not found for router_id=%s hostname=%s", info.RouterID, info.Hostname)
-				continue
-			}
-		case info.HasBGP:
-			if info.BGPASN == 0 {
-				log.Printf("bgp payload missing ASN for router_id=%s hostname=%s", info.RouterID, info.Hostname)
-				continue
-			}
-			ok, err := client.UpdateBGP(ctx, info.RouterID, info.BGPASN, update)
-			if err != nil {
-				log.Printf("bgp update failed for %s: %v", info.RouterID, err)
-				continue
-			}
-			if !ok {
-				log.Printf("bgp node not found for router_id=%s asn=%d", info.RouterID, info.BGPASN)
-				continue
-			}
-		default:
-			log.Printf("payload missing IGP/BGP markers for target=%s", payload.Target)
-			continue
-		}
+// apply writes a payload to every collection it matches; the error is for a
+// payload that cannot be matched at all.
+func apply(ctx context.Context, client *ingest.ArangoClient, keys []string, payload *gnmi.ConfigMessage) ([]ingest.Match, []ingest.Result, error) {
+	info, err := ingest.ExtractMatchInfo(payload.Updates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	update := map[string]interface{}{
+		"running_config":       payload,
+		"config_ts":            payload.Timestamp,
+		ingest.ConfigHashField: payload.ConfigHash(),
+		"config_source": map[string]interface{}{
+			"target":  payload.Target,
+			"address": payload.Address,
+		},
+	}
 
-		log.Printf("stored config for target=%s router_id=%s", payload.Target, info.RouterID)
+	candidates := info.Candidates(keys)
+	results := client.Update(ctx, info, candidates, update)
+	if _, err := client.RecordHistory(ctx, payload); err != nil {
+		log.Printf("config history for target=%s: %v", payload.Target, err)
 	}
+	return candidates, results, nil
 }
 
-func splitComma(raw string) []string {
-	out := []string{}
-	for _, part := range strings.Split(raw, ",") {
-		part = strings.TrimSpace(part)
-		if part != "" {
-			out = append(out, part)
+// summarize reports each collection's outcome, e.g.
+// "igp_node: 1 updated by router_id=10.0.0.1; bgp_node: skipped (no BGP in config)".
+func summarize(results []ingest.Result, candidates []ingest.Match) string {
+	parts := make([]string, 0, len(results))
+	for _, r := range results {
+		var part string
+		switch {
+		case r.Err != nil:
+			part = fmt.Sprintf("%s: failed: %v", r.Collection, r.Err)
+		case r.Skipped != "":
+			part = fmt.Sprintf("%s: skipped (%s)", r.Collection, r.Skipped)
+		case r.Updated == 0 && r.Newer > 0:
+			part = fmt.Sprintf("%s: %d kept, newer than payload (%s=%s)", r.Collection, r.Newer, r.Match.Key, r.Match.Value)
+		case r.Updated == 0:
+			part = fmt.Sprintf("%s: not found for %v", r.Collection, candidates)
+		default:
+			part = fmt.Sprintf("%s: %d updated by %s=%s", r.Collection, r.Updated, r.Match.Key, r.Match.Value)
 		}
+		parts = append(parts, part)
 	}
-	return out
+	return strings.Join(parts, "; ")
 }
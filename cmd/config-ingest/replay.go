@@ -0,0 +1,365 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/format"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"github.com/jalapeno/config-pub/internal/ingest"
+	pubkafka "github.com/jalapeno/config-pub/internal/kafka"
+	"github.com/segmentio/kafka-go"
+)
+
+const replayUsage = `usage: config-ingest replay [flags]
+
+Reapplies the newest config per host from a Kafka topic, read outside the
+consumer group, or from a directory of payload files (*.json, *.json.gz).
+Documents already holding a newer config are left alone.
+
+`
+
+const replayIdle = 10 * time.Second
+
+// replaySource is where replay reads payloads from and which of them count.
+type replaySource struct {
+	dir   string
+	from  string
+	since time.Time
+	until time.Time
+}
+
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), replayUsage)
+		fs.PrintDefaults()
+	}
+	flags := bindFlags(fs)
+	var (
+		src          replaySource
+		since, until string
+	)
+	fs.StringVar(&src.dir, "dir", "", "Replay payload files under this directory instead of Kafka")
+	fs.StringVar(&src.from, "from-offset", "first", "Offset to start each partition at: first or a number")
+	fs.StringVar(&since, "since", "", "Only payloads at or after this time (RFC 3339, or a duration ago such as 24h); overrides -from-offset")
+	fs.StringVar(&until, "until", "", "Only payloads at or before this time (RFC 3339, or a duration ago)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	var err error
+	if src.since, err = parseTime(since); err != nil {
+		fmt.Fprintf(os.Stderr, "-since: %v\n", err)
+		return 2
+	}
+	if src.until, err = parseTime(until); err != nil {
+		fmt.Fprintf(os.Stderr, "-until: %v\n", err)
+		return 2
+	}
+	if src.from != "first" {
+		if _, err := strconv.ParseInt(src.from, 10, 64); err != nil {
+			fmt.Fprintf(os.Stderr, "-from-offset: %q is not first or a number\n", src.from)
+			return 2
+		}
+	}
+
+	opts, err := flags.load(fs, src.dir == "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	latest := newestPayloads{}
+	if src.dir != "" {
+		err = readPayloadDir(src, latest)
+	} else {
+		err = readTopics(ctx, opts, src, latest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	arango := opts.arango()
+	arango.KeepNewer = true
+	client, err := ingest.NewArangoClient(arango)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "arango client: %v\n", err)
+		return 1
+	}
+
+	var cov coverage
+	for _, host := range latest.hosts() {
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "replay: %v\n", ctx.Err())
+			return 1
+		}
+		payload := latest[host]
+		candidates, results, err := apply(ctx, client, opts.keys, payload)
+		outcome := cov.add(results, err)
+		detail := summarize(results, candidates)
+		if err != nil {
+			detail = err.Error()
+		}
+		fmt.Printf("%-9s %s (%s): %s\n", outcome, host, payload.Timestamp.Format(time.RFC3339), detail)
+	}
+	fmt.Printf("replayed %d hosts: %d matched, %d unmatched, %d stale, %d failed\n",
+		len(latest), cov.matched, cov.unmatched, cov.stale, cov.failed)
+	if cov.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseTime reads an RFC 3339 time or a duration before now; empty is the
+// zero time.
+func parseTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func (s replaySource) wants(ts time.Time) bool {
+	if !s.since.IsZero() && ts.Before(s.since) {
+		return false
+	}
+	return s.until.IsZero() || !ts.After(s.until)
+}
+
+// newestPayloads keeps the newest payload per host, by target or, without
+// one, address.
+type newestPayloads map[string]*gnmi.ConfigMessage
+
+func (n newestPayloads) add(payload *gnmi.ConfigMessage) {
+	host := payload.Target
+	if host == "" {
+		host = payload.Address
+	}
+	if cur, ok := n[host]; ok && cur.Timestamp.After(payload.Timestamp) {
+		return
+	}
+	n[host] = payload
+}
+
+func (n newestPayloads) hosts() []string {
+	hosts := make([]string, 0, len(n))
+	for host := range n {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// coverage counts hosts by outcome: matched when a document took the
+// config, stale when the matched documents all hold a newer one, unmatched
+// when no document matched, failed on errors.
+type coverage struct {
+	matched, unmatched, stale, failed int
+}
+
+func (c *coverage) add(results []ingest.Result, err error) string {
+	if err != nil {
+		c.unmatched++
+		return "unmatched"
+	}
+	var updated, newer, failed int
+	for _, r := range results {
+		updated += r.Updated
+		newer += r.Newer
+		if r.Err != nil {
+			failed++
+		}
+	}
+	switch {
+	case failed > 0:
+		c.failed++
+		return "failed"
+	case updated > 0:
+		c.matched++
+		return "matched"
+	case newer > 0:
+		c.stale++
+		return "stale"
+	default:
+		c.unmatched++
+		return "unmatched"
+	}
+}
+
+// readTopics reads every partition of the configured topics from the
+// start offset to the end as of now, without a consumer group.
+func readTopics(ctx context.Context, opts *options, src replaySource, latest newestPayloads) error {
+	cfg := opts.cfg.Kafka
+	var (
+		partitions []kafka.Partition
+		err        error
+	)
+	for _, broker := range cfg.Brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			continue
+		}
+		partitions, err = conn.ReadPartitions(cfg.Topics...)
+		conn.Close()
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	reassembler := pubkafka.NewReassembler(opts.cfg.Retention.Chunks)
+	for _, p := range partitions {
+		if err := readPartition(ctx, cfg.Brokers, p, src, reassembler, opts.schemas, latest); err != nil {
+			return fmt.Errorf("%s/%d: %w", p.Topic, p.ID, err)
+		}
+	}
+	return nil
+}
+
+func readPartition(ctx context.Context, brokers []string, p kafka.Partition, src replaySource, reassembler *pubkafka.Reassembler, schemas *format.Decoder, latest newestPayloads) error {
+	// The partition already names its leader, so no broker is asked again;
+	// the first one may be the one that was down when listing.
+	conn, err := kafka.DialPartition(ctx, "tcp", "", p)
+	if err != nil {
+		return err
+	}
+	first, last, err := conn.ReadOffsets()
+	if err == nil && !src.since.IsZero() {
+		first, err = conn.ReadOffset(src.since)
+	} else if err == nil && src.from != "first" {
+		offset, _ := strconv.ParseInt(src.from, 10, 64)
+		first = max(first, offset)
+	}
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	if first >= last {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     p.Topic,
+		Partition: p.ID,
+		MaxWait:   time.Second,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return err
+	}
+	read := 0
+	for {
+		// The last offset may be a gap, e.g. a transaction marker; a
+		// partition idle this long is read.
+		readCtx, cancel := context.WithTimeout(ctx, replayIdle)
+		msg, err := reader.ReadMessage(readCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !src.until.IsZero() && msg.Time.After(src.until) {
+			break
+		}
+		value, headers, complete, err := reassembler.Add(msg)
+		switch {
+		case err != nil:
+			log.Printf("%s/%d@%d: reassemble chunks: %v", p.Topic, p.ID, msg.Offset, err)
+		case complete:
+			read++
+			payload, err := decodePayload(ctx, schemas, value, headers)
+			if err != nil {
+				log.Printf("%s/%d@%d: %v", p.Topic, p.ID, msg.Offset, err)
+			} else if src.wants(payload.Timestamp) {
+				latest.add(payload)
+			}
+		}
+		if msg.Offset >= last-1 {
+			break
+		}
+	}
+	log.Printf("read %d payloads from %s/%d offsets %d-%d", read, p.Topic, p.ID, first, last-1)
+	return nil
+}
+
+// readPayloadDir reads the payload files under src.dir. Each holds one
+// payload in JSON, as config-pub publishes it, optionally gzipped.
+func readPayloadDir(src replaySource, latest newestPayloads) error {
+	read := 0
+	err := filepath.WalkDir(src.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !(strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".json.gz")) {
+			return nil
+		}
+		payload, err := readPayloadFile(path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			return nil
+		}
+		read++
+		if src.wants(payload.Timestamp) {
+			latest.add(payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if read == 0 {
+		return errors.New("no payload files in " + src.dir)
+	}
+	log.Printf("read %d payload files from %s", read, src.dir)
+	return nil
+}
+
+func readPayloadFile(path string) (*gnmi.ConfigMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var payload gnmi.ConfigMessage
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	return &payload, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jalapeno/config-pub/internal/inventory"
+	"gopkg.in/yaml.v3"
+)
+
+const inventoryUsage = `usage: config-pub inventory <command> [flags]
+
+commands:
+  import-clab   print a hosts: section for a containerlab topology
+`
+
+func runInventory(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, inventoryUsage)
+		return 2
+	}
+	switch args[0] {
+	case "import-clab":
+		return runImportClab(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown inventory command %q\n\n%s", args[0], inventoryUsage)
+		return 2
+	}
+}
+
+// clabHostOut mirrors config.Host with omitempty so the generated section
+// only lists what the importer set.
+type clabHostOut struct {
+	Name     string   `yaml:"name"`
+	Address  string   `yaml:"address"`
+	Target   string   `yaml:"target,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	Insecure *bool    `yaml:"insecure,omitempty"`
+	Paths    []string `yaml:"paths,omitempty"`
+}
+
+func runImportClab(args []string) int {
+	fs := flag.NewFlagSet("import-clab", flag.ContinueOnError)
+	var (
+		opts   inventory.ClabOptions
+		kinds  string
+		output string
+	)
+	fs.StringVar(&opts.TopologyFile, "topology", "", "Path to the containerlab topology file")
+	fs.StringVar(&opts.InventoryFile, "inventory", "", "Path to the clab-generated ansible-inventory.yml (for nodes without static mgmt addresses)")
+	fs.StringVar(&kinds, "kind", "", "Comma-separated node kinds to import (default: every kind with a built-in profile)")
+	fs.IntVar(&opts.Port, "port", 0, "gNMI port (default: per-kind profile)")
+	fs.StringVar(&opts.Username, "username", "", "gNMI username (default: per-kind profile)")
+	fs.StringVar(&opts.Password, "password", "", "gNMI password (default: per-kind profile)")
+	fs.StringVar(&output, "output", "", "Write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.TopologyFile == "" {
+		fmt.Fprintln(os.Stderr, "-topology is required")
+		return 2
+	}
+	opts.Kinds = splitComma(kinds)
+
+	hosts, skipped, err := inventory.ImportClab(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import clab topology: %v\n", err)
+		return 1
+	}
+	for _, name := range skipped {
+		fmt.Fprintf(os.Stderr, "skipping %s: no management address (pass -inventory)\n", name)
+	}
+
+	out := struct {
+		Hosts []clabHostOut `yaml:"hosts"`
+	}{Hosts: make([]clabHostOut, 0, len(hosts))}
+	for _, h := range hosts {
+		out.Hosts = append(out.Hosts, clabHostOut{
+			Name:     h.Name,
+			Address:  h.Address,
+			Target:   h.Target,
+			Username: h.Username,
+			Password: h.Password,
+			Insecure: h.Insecure,
+			Paths:    h.Paths,
+		})
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create output: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "write hosts: %v\n", err)
+		return 1
+	}
+	if err := enc.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "write hosts: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func splitComma(raw string) []string {
+	out := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -3,18 +3,32 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
-	"time"
 
+	"github.com/jalapeno/config-pub/internal/admin"
+	"github.com/jalapeno/config-pub/internal/certs"
+	"github.com/jalapeno/config-pub/internal/cli"
+	"github.com/jalapeno/config-pub/internal/collect"
 	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/coord"
 	"github.com/jalapeno/config-pub/internal/gnmi"
+	"github.com/jalapeno/config-pub/internal/inventory"
 	"github.com/jalapeno/config-pub/internal/kafka"
+	"github.com/jalapeno/config-pub/internal/netconf"
+	"github.com/jalapeno/config-pub/internal/schedule"
+	"github.com/jalapeno/config-pub/internal/syslog"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inventory" {
+		os.Exit(runInventory(os.Args[2:]))
+	}
+
 	var configPath string
 	flag.StringVar(&configPath, "config", "/etc/config-pub/config.yaml", "Path to config file")
 	flag.Parse()
@@ -41,45 +55,121 @@ func main() {
 	}
 	defer publisher.Close()
 
-	collector := gnmi.NewCollector(cfg.GNMI)
+	watcher := certs.NewWatcher(cfg.Certificates)
+	go watcher.Run(ctx)
 
-	run := func() {
-		log.Print("starting collection cycle")
-		for _, host := range cfg.Hosts {
-			hostCfg := host.Resolve(cfg.GNMI)
-			msg, err := collector.Collect(ctx, hostCfg)
-			if err != nil {
-				log.Printf("collect failed for %s (%s): %v", hostCfg.Name, hostCfg.Address, err)
-				continue
-			}
-			if err := publisher.Publish(ctx, hostCfg, msg); err != nil {
-				log.Printf("kafka publish failed for %s (%s): %v", hostCfg.Name, hostCfg.Address, err)
+	collector := collect.NewMux(map[string]collect.Collector{
+		collect.ProtocolGNMI:    gnmi.NewCollector(cfg.GNMI, watcher),
+		collect.ProtocolSSH:     cli.NewCollector(),
+		collect.ProtocolNETCONF: netconf.NewCollector(),
+	})
+	defer collector.Close()
+
+	inv, err := inventory.New(cfg)
+	if err != nil {
+		log.Fatalf("init inventory: %v", err)
+	}
+	inv.Refresh(ctx)
+	go inv.Run(ctx)
+
+	coordinator, err := coord.New(cfg.Coordination)
+	if err != nil {
+		log.Fatalf("init coordination: %v", err)
+	}
+	if coordinator != nil {
+		coordinator.Start(ctx)
+		defer coordinator.Close()
+	}
+
+	// The scheduler reads the hosts every tick; they are only resolved again
+	// when the inventory or this replica's share of it changed.
+	var (
+		resolved    []config.HostResolved
+		resolvedFor [2]uint64
+	)
+	hosts := func() []config.HostResolved {
+		version := [2]uint64{inv.Version(), coordinator.Version()}
+		if resolved != nil && version == resolvedFor {
+			return resolved
+		}
+		hosts := inv.Hosts()
+		names := make([]string, 0, len(hosts))
+		resolved = make([]config.HostResolved, 0, len(hosts))
+		for _, host := range hosts {
+			if !coordinator.Owns(host.Name) {
 				continue
 			}
-			log.Printf("published config for %s (%s)", hostCfg.Name, hostCfg.Address)
+			names = append(names, host.Name)
+			resolved = append(resolved, host.Resolve(cfg))
 		}
+		resolvedFor = version
+		collector.Retain(names)
+		return resolved
 	}
 
+	job := func(ctx context.Context, hostCfg config.HostResolved) schedule.Result {
+		msg, err := collector.Collect(ctx, hostCfg)
+		if err != nil {
+			log.Printf("collect failed for %s (%s): %v", hostCfg.Name, hostCfg.Address, err)
+			return schedule.Result{Err: fmt.Errorf("collect: %w", err)}
+		}
+		delivery, err := publisher.Publish(ctx, hostCfg, msg)
+		if err != nil {
+			log.Printf("kafka publish failed for %s (%s): %v", hostCfg.Name, hostCfg.Address, err)
+			return schedule.Result{Err: fmt.Errorf("publish: %w", err)}
+		}
+		log.Printf("published config for %s (%s)", hostCfg.Name, hostCfg.Address)
+		return schedule.Result{
+			Bytes:      delivery.Bytes,
+			ConfigHash: msg.ConfigHash(),
+			Partition:  delivery.Partition,
+			Offset:     delivery.Offset,
+		}
+	}
+
+	scheduler := schedule.New(hosts, job, cfg.Concurrency)
 	if cfg.RunOnce {
-		run()
+		scheduler.RunOnce(ctx)
 		return
 	}
 
-	if cfg.Interval <= 0 {
-		log.Print("interval not set; defaulting to 5m")
-		cfg.Interval = 5 * time.Minute
+	if cfg.Admin.Listen != "" {
+		server := admin.New(scheduler, cfg.Admin.Token)
+		server.Handle("GET /metrics", watcher.MetricsHandler())
+		if coordinator != nil {
+			server.Route(func(name string) string {
+				if coordinator.Owns(name) || !slices.ContainsFunc(inv.Hosts(), func(h config.Host) bool { return h.Name == name }) {
+					return ""
+				}
+				return coordinator.Owner(name)
+			})
+		}
+		go func() {
+			if err := server.Run(ctx, cfg.Admin.Listen); err != nil {
+				log.Printf("admin api: %v", err)
+			}
+		}()
 	}
-
-	ticker := time.NewTicker(cfg.Interval)
-	defer ticker.Stop()
-
-	run()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			run()
+	if cfg.Syslog != nil {
+		trigger := func(name string) error {
+			if !coordinator.Owns(name) {
+				return nil
+			}
+			return scheduler.Trigger(name, func(result schedule.Result) {
+				if result.Err == nil {
+					log.Printf("syslog-triggered collection of %s done in %s", name, result.Duration)
+				}
+			})
+		}
+		listener, err := syslog.New(*cfg.Syslog, inv.Hosts, trigger)
+		if err != nil {
+			log.Fatalf("init syslog listener: %v", err)
 		}
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				log.Printf("syslog listener: %v", err)
+			}
+		}()
 	}
+	scheduler.Run(ctx)
 }
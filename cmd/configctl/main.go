@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/configdb"
+	"github.com/jalapeno/config-pub/internal/ingest"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage: configctl [flags] <command> [command flags] [args]
+
+Commands:
+  show <node>                 latest config of a node (name, router ID or ASN)
+  history <node>              stored config versions of a node, newest first
+  diff <node> <ver> <ver>     compare two versions (number, 0 newest, or hash prefix)
+  diff <node> <node>          compare the latest configs of two nodes
+  grep <regexp>               leaves matching across all nodes
+
+Flags:
+`
+
+// Output formats.
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputTree = "tree"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+func run(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("configctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	var (
+		configPath  string
+		dbURL       string
+		dbName      string
+		dbUserFile  string
+		dbPassFile  string
+		collections string
+		history     string
+		output      string
+		timeout     time.Duration
+	)
+	fs.StringVar(&configPath, "config", os.Getenv(config.IngestEnvPrefix+"CONFIG"), "config-ingest config file for the Arango settings (optional)")
+	fs.StringVar(&dbURL, "database-server", "", "ArangoDB endpoint; several coordinators comma-separated")
+	fs.StringVar(&dbName, "database-name", "", "ArangoDB database name")
+	fs.StringVar(&dbUserFile, "database-user-file", "", "Path to ArangoDB username file")
+	fs.StringVar(&dbPassFile, "database-pass-file", "", "Path to ArangoDB password file")
+	fs.StringVar(&collections, "collections", "", "Node collections to read (comma-separated; default: the config's match collections)")
+	fs.StringVar(&history, "history-collection", "", "Config history collection (default: the config's)")
+	fs.StringVar(&output, "output", outputTree, "Output format: json, yaml or tree")
+	fs.DurationVar(&timeout, "timeout", time.Minute, "Give up after this long")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	switch output {
+	case outputJSON, outputYAML, outputTree:
+	default:
+		fmt.Fprintf(os.Stderr, "-output: %q is not json, yaml or tree\n", output)
+		return 2
+	}
+
+	// The Arango settings and credentials are config-ingest's: its file,
+	// CONFIG_INGEST_* variables, then these flags.
+	cfg, err := config.LoadIngest(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		return 2
+	}
+	if eps := splitComma(dbURL); len(eps) > 0 {
+		cfg.Arango.URL, cfg.Arango.Endpoints = "", eps
+	}
+	if dbName != "" {
+		cfg.Arango.Database = dbName
+	}
+	if dbUserFile != "" {
+		cfg.Arango.UserFile = dbUserFile
+	}
+	if dbPassFile != "" {
+		cfg.Arango.PassFile = dbPassFile
+	}
+	if history != "" {
+		cfg.Arango.HistoryCollection = history
+	}
+	names := splitComma(collections)
+	if len(names) == 0 {
+		for _, entry := range cfg.Match.Collections {
+			name, _, _ := strings.Cut(entry, ":")
+			names = append(names, name)
+		}
+	}
+	if cfg.Arango.URL == "" && len(cfg.Arango.Endpoints) == 0 || cfg.Arango.Database == "" {
+		fmt.Fprintln(os.Stderr, "the Arango url and database are required (-config, CONFIG_INGEST_ARANGO_*, or -database-server and -database-name)")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	db, err := ingest.OpenDatabase(ingest.ArangoConfigFrom(cfg.Arango.ArangoConfig))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	store := configdb.NewStore(db, names, cfg.Arango.HistoryCollection)
+	out := &printer{w: stdout, format: output}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "show":
+		err = runShow(ctx, store, out, cmdArgs)
+	case "history":
+		err = runHistory(ctx, store, out, cmdArgs)
+	case "diff":
+		err = runDiff(ctx, store, out, cmdArgs)
+	case "grep":
+		err = runGrep(ctx, store, out, cmdArgs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		fs.Usage()
+		return 2
+	}
+	var usageErr *usageError
+	switch {
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// usageError is a mistake on the command line rather than a failure.
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+func runShow(ctx context.Context, store *configdb.Store, out *printer, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	by := fs.String("by", configdb.ByAuto, "Match the node by auto, name, router-id or asn")
+	version := fs.String("version", "", "Show this history version instead of the latest config")
+	if err := fs.Parse(args); err != nil {
+		return usagef("%v", err)
+	}
+	if fs.NArg() != 1 {
+		return usagef("want one node")
+	}
+	nodes, err := store.Find(ctx, *by, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no stored config for %q", fs.Arg(0))
+	}
+	if *version != "" {
+		if len(nodes) > 1 {
+			return ambiguous(fs.Arg(0), nodes)
+		}
+		v, err := findVersion(ctx, store, nodes[0].Target, *version)
+		if err != nil {
+			return err
+		}
+		nodes[0].ConfigTS, nodes[0].ConfigHash, nodes[0].RunningConfig = v.ConfigTS, v.ConfigHash, v.RunningConfig
+	}
+	if out.format != outputTree {
+		return out.data(nodes)
+	}
+	for i, node := range nodes {
+		if i > 0 {
+			fmt.Fprintln(out.w)
+		}
+		fmt.Fprintf(out.w, "# %s (%s) %s %s\n", node.Target, strings.Join(node.Documents, ", "), node.ConfigTS.Format(time.RFC3339), node.ConfigHash)
+		configdb.WriteTree(out.w, node.RunningConfig)
+	}
+	return nil
+}
+
+func runHistory(ctx context.Context, store *configdb.Store, out *printer, args []string) error {
+	node, err := oneNode(ctx, store, args)
+	if err != nil {
+		return err
+	}
+	versions, err := store.History(ctx, node.Target)
+	if err != nil {
+		return err
+	}
+	if out.format != outputTree {
+		for i := range versions {
+			versions[i].RunningConfig = nil
+		}
+		return out.data(versions)
+	}
+	if len(versions) == 0 {
+		fmt.Fprintf(out.w, "no history for %s\n", node.Target)
+		return nil
+	}
+	for _, v := range versions {
+		fmt.Fprintf(out.w, "%3d  %s  %s\n", v.Index, v.ConfigTS.Format(time.RFC3339), v.ConfigHash)
+	}
+	return nil
+}
+
+func runDiff(ctx context.Context, store *configdb.Store, out *printer, args []string) error {
+	var (
+		labelA, labelB string
+		a, b           []configdb.Entry
+	)
+	switch len(args) {
+	case 2:
+		nodeA, err := oneNode(ctx, store, args[:1])
+		if err != nil {
+			return err
+		}
+		nodeB, err := oneNode(ctx, store, args[1:])
+		if err != nil {
+			return err
+		}
+		labelA, labelB = nodeA.Target, nodeB.Target
+		a, b = configdb.Flatten(nodeA.RunningConfig), configdb.Flatten(nodeB.RunningConfig)
+	case 3:
+		node, err := oneNode(ctx, store, args[:1])
+		if err != nil {
+			return err
+		}
+		va, err := findVersion(ctx, store, node.Target, args[1])
+		if err != nil {
+			return err
+		}
+		vb, err := findVersion(ctx, store, node.Target, args[2])
+		if err != nil {
+			return err
+		}
+		labelA = fmt.Sprintf("%s@%d", node.Target, va.Index)
+		labelB = fmt.Sprintf("%s@%d", node.Target, vb.Index)
+		a, b = configdb.Flatten(va.RunningConfig), configdb.Flatten(vb.RunningConfig)
+	default:
+		return usagef("want <node> <version> <version> or <node> <node>")
+	}
+
+	changes := configdb.Diff(a, b)
+	if out.format != outputTree {
+		return out.data(changes)
+	}
+	fmt.Fprintf(out.w, "--- %s\n+++ %s\n", labelA, labelB)
+	for _, c := range changes {
+		fmt.Fprintln(out.w, c)
+	}
+	return nil
+}
+
+// grepMatch is one leaf grep found.
+type grepMatch struct {
+	Target string `json:"target"`
+	Path   string `json:"path"`
+	Value  string `json:"value,omitempty"`
+}
+
+func runGrep(ctx context.Context, store *configdb.Store, out *printer, args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	pathOnly := fs.Bool("path", false, "Match the path only")
+	valueOnly := fs.Bool("value", false, "Match the value only (JSON leaves; text config lines are paths)")
+	ignoreCase := fs.Bool("i", false, "Ignore case")
+	if err := fs.Parse(args); err != nil {
+		return usagef("%v", err)
+	}
+	if fs.NArg() != 1 || *pathOnly && *valueOnly {
+		return usagef("want one pattern and at most one of -path and -value")
+	}
+	pattern := fs.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	nodes, err := store.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+	matches := []grepMatch{}
+	for _, node := range nodes {
+		for _, e := range configdb.Flatten(node.RunningConfig) {
+			subject := e.String()
+			if *pathOnly {
+				subject = e.Path
+			} else if *valueOnly {
+				subject = e.Value
+			}
+			if re.MatchString(subject) {
+				matches = append(matches, grepMatch{Target: node.Target, Path: e.Path, Value: e.Value})
+			}
+		}
+	}
+	if out.format != outputTree {
+		return out.data(matches)
+	}
+	for _, m := range matches {
+		fmt.Fprintf(out.w, "%s: %s\n", m.Target, configdb.Entry{Path: m.Path, Value: m.Value})
+	}
+	return nil
+}
+
+// oneNode resolves a node argument to exactly one stored config.
+func oneNode(ctx context.Context, store *configdb.Store, args []string) (configdb.Node, error) {
+	if len(args) != 1 {
+		return configdb.Node{}, usagef("want one node")
+	}
+	nodes, err := store.Find(ctx, configdb.ByAuto, args[0])
+	if err != nil {
+		return configdb.Node{}, err
+	}
+	switch len(nodes) {
+	case 0:
+		return configdb.Node{}, fmt.Errorf("no stored config for %q", args[0])
+	case 1:
+		return nodes[0], nil
+	default:
+		return configdb.Node{}, ambiguous(args[0], nodes)
+	}
+}
+
+func ambiguous(key string, nodes []configdb.Node) error {
+	targets := make([]string, len(nodes))
+	for i, n := range nodes {
+		targets[i] = n.Target
+	}
+	return fmt.Errorf("%q matches %d nodes (%s); name one", key, len(nodes), strings.Join(targets, ", "))
+}
+
+// findVersion picks a history version by number, 0 the newest, or by a
+// prefix of its config hash.
+func findVersion(ctx context.Context, store *configdb.Store, target, ref string) (configdb.Version, error) {
+	versions, err := store.History(ctx, target)
+	if err != nil {
+		return configdb.Version{}, err
+	}
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i < 0 || i >= len(versions) {
+			return configdb.Version{}, fmt.Errorf("%s has %d versions, no version %d", target, len(versions), i)
+		}
+		return versions[i], nil
+	}
+	var found []configdb.Version
+	for _, v := range versions {
+		if strings.HasPrefix(strings.TrimPrefix(v.ConfigHash, "sha256:"), strings.TrimPrefix(ref, "sha256:")) {
+			found = append(found, v)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return configdb.Version{}, fmt.Errorf("%s has no version %q", target, ref)
+	case 1:
+		return found[0], nil
+	default:
+		return configdb.Version{}, fmt.Errorf("%q matches %d versions of %s", ref, len(found), target)
+	}
+}
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// data writes v as JSON, or as YAML with the same field names.
+func (p *printer) data(v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if p.format == outputJSON {
+		_, err := p.w.Write(buf.Bytes())
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(buf.Bytes(), &generic); err != nil {
+		return err
+	}
+	out := yaml.NewEncoder(p.w)
+	out.SetIndent(2)
+	if err := out.Encode(generic); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func splitComma(raw string) []string {
+	out := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -6,8 +6,11 @@ toolchain go1.23.6
 
 require (
 	github.com/arangodb/go-driver v1.6.0
+	github.com/klauspost/compress v1.15.9
 	github.com/openconfig/gnmi v0.13.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/segmentio/kafka-go v0.4.47
+	golang.org/x/crypto v0.35.0
 	google.golang.org/grpc v1.70.0
 	google.golang.org/protobuf v1.36.5
 	gopkg.in/yaml.v3 v3.0.1
@@ -15,7 +18,6 @@ require (
 
 require (
 	github.com/arangodb/go-velocypack v0.0.0-20200318135517-5af53c29c67e // indirect
-	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/net v0.35.0 // indirect
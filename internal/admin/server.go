@@ -0,0 +1,413 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/schedule"
+)
+
+// maxJobs bounds how many finished jobs are kept for status queries.
+const maxJobs = 100
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusPartial   = "partial"
+)
+
+// Server exposes on-demand collection, job status and host state over HTTP.
+type Server struct {
+	sched *schedule.Scheduler
+	token string
+	extra map[string]http.Handler
+	owner func(host string) string
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string
+}
+
+type job struct {
+	ID       string                 `json:"id"`
+	Status   string                 `json:"status"`
+	Created  time.Time              `json:"created"`
+	Finished *time.Time             `json:"finished,omitempty"`
+	Hosts    map[string]*hostResult `json:"hosts"`
+
+	pending int
+	done    chan struct{}
+}
+
+type hostResult struct {
+	Status     string     `json:"status"`
+	Started    *time.Time `json:"started,omitempty"`
+	Duration   string     `json:"duration,omitempty"`
+	Bytes      int        `json:"bytes,omitempty"`
+	ConfigHash string     `json:"config_hash,omitempty"`
+	Partition  *int       `json:"partition,omitempty"`
+	Offset     *int64     `json:"offset,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// New returns a Server. When token is set every request must carry it as a
+// bearer token.
+func New(sched *schedule.Scheduler, token string) *Server {
+	return &Server{sched: sched, token: token, extra: map[string]http.Handler{}, jobs: map[string]*job{}}
+}
+
+// Handle adds a route served next to the API, behind the same token. Call it
+// before Run.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.extra[pattern] = handler
+}
+
+// Route reports hosts that another replica collects: a request for such a
+// host is answered 421 with the replica owner returns for it. owner returns
+// "" for hosts it does not know and for this replica's own. Call it before
+// Run.
+func (s *Server) Route(owner func(host string) string) {
+	s.owner = owner
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /v1/collect", s.handleCollect)
+	mux.HandleFunc("GET /v1/jobs", s.handleJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /v1/hosts", s.handleHosts)
+	mux.HandleFunc("GET /v1/hosts/{name}", s.handleHost)
+	mux.HandleFunc("POST /v1/hosts/{name}/pause", s.handlePause)
+	mux.HandleFunc("POST /v1/hosts/{name}/resume", s.handleResume)
+	for pattern, handler := range s.extra {
+		mux.Handle(pattern, handler)
+	}
+	return s.authenticate(mux)
+}
+
+// Run serves the API on addr until ctx is done.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("admin api listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCollect triggers collection of the hosts named by host=, the members
+// of group=, or every host with all=true. With wait=true the response is sent
+// once the job finishes.
+func (s *Server) handleCollect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	names, err := s.selectHosts(query["host"], query["group"], query.Get("all") == "true")
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	j, err := s.start(names)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if query.Get("wait") != "true" {
+		s.writeJob(w, http.StatusAccepted, j)
+		return
+	}
+	select {
+	case <-j.done:
+		s.writeJob(w, http.StatusOK, j)
+	case <-r.Context().Done():
+	}
+}
+
+func (s *Server) selectHosts(hosts, groups []string, all bool) ([]string, error) {
+	if len(hosts) == 0 && len(groups) == 0 && !all {
+		return nil, fmt.Errorf("%w: one of host, group or all=true is required", errBadRequest)
+	}
+
+	states := s.sched.States()
+	known := make(map[string]bool, len(states))
+	selected := map[string]bool{}
+	for _, st := range states {
+		known[st.Name] = true
+		if all {
+			selected[st.Name] = true
+		}
+		for _, group := range groups {
+			if slices.Contains(st.Groups, group) {
+				selected[st.Name] = true
+			}
+		}
+	}
+	for _, name := range hosts {
+		if !known[name] {
+			return nil, s.route(name, fmt.Errorf("%w: %s", schedule.ErrUnknownHost, name))
+		}
+		selected[name] = true
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("%w: no hosts matched", errNotFound)
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Server) start(names []string) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		ID:      id,
+		Status:  StatusRunning,
+		Created: time.Now().UTC(),
+		Hosts:   make(map[string]*hostResult, len(names)),
+		pending: len(names),
+		done:    make(chan struct{}),
+	}
+	for _, name := range names {
+		j.Hosts[name] = &hostResult{Status: StatusPending}
+	}
+
+	s.mu.Lock()
+	s.jobs[id] = j
+	s.order = append(s.order, id)
+	for len(s.order) > maxJobs {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		name := name
+		err := s.sched.Trigger(name, func(result schedule.Result) {
+			s.record(j, name, result)
+		})
+		if err != nil {
+			s.record(j, name, schedule.Result{Started: time.Now(), Err: err})
+		}
+	}
+	log.Printf("admin: started job %s for %d host(s)", id, len(names))
+	return j, nil
+}
+
+func (s *Server) record(j *job, name string, result schedule.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := j.Hosts[name]
+	started := result.Started.UTC()
+	res.Started = &started
+	res.Duration = result.Duration.String()
+	if result.Err != nil {
+		res.Status = StatusFailed
+		res.Error = result.Err.Error()
+	} else {
+		res.Status = StatusSucceeded
+		res.Bytes = result.Bytes
+		res.ConfigHash = result.ConfigHash
+		partition, offset := result.Partition, result.Offset
+		res.Partition, res.Offset = &partition, &offset
+	}
+
+	j.pending--
+	if j.pending > 0 {
+		return
+	}
+	failed := 0
+	for _, r := range j.Hosts {
+		if r.Status == StatusFailed {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		j.Status = StatusSucceeded
+	case failed == len(j.Hosts):
+		j.Status = StatusFailed
+	default:
+		j.Status = StatusPartial
+	}
+	finished := time.Now().UTC()
+	j.Finished = &finished
+	close(j.done)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*job, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[s.order[i]])
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	j, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: job %s", errNotFound, r.PathValue("id")))
+		return
+	}
+	s.writeJob(w, http.StatusOK, j)
+}
+
+func (s *Server) writeJob(w http.ResponseWriter, code int, j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, code, j)
+}
+
+func (s *Server) handleHosts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.sched.States())
+}
+
+func (s *Server) handleHost(w http.ResponseWriter, r *http.Request) {
+	st, err := s.sched.State(r.PathValue("name"))
+	if err != nil {
+		err = s.route(r.PathValue("name"), err)
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r.PathValue("name"), s.sched.Pause)
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r.PathValue("name"), s.sched.Resume)
+}
+
+func (s *Server) setPaused(w http.ResponseWriter, name string, apply func(string) error) {
+	if err := apply(name); err != nil {
+		err = s.route(name, err)
+		writeError(w, statusFor(err), err)
+		return
+	}
+	st, err := s.sched.State(name)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+var (
+	errBadRequest = errors.New("bad request")
+	errNotFound   = errors.New("not found")
+)
+
+// misdirectedError is a request for a host another replica collects.
+type misdirectedError struct {
+	host  string
+	owner string
+}
+
+func (e *misdirectedError) Error() string {
+	return fmt.Sprintf("host %s is collected by %s", e.host, e.owner)
+}
+
+// route turns an unknown-host error into a misdirectedError when another
+// replica collects the host.
+func (s *Server) route(host string, err error) error {
+	if s.owner == nil || !errors.Is(err, schedule.ErrUnknownHost) {
+		return err
+	}
+	if owner := s.owner(host); owner != "" {
+		return &misdirectedError{host: host, owner: owner}
+	}
+	return err
+}
+
+func statusFor(err error) int {
+	var misdirected *misdirectedError
+	switch {
+	case errors.As(err, &misdirected):
+		return http.StatusMisdirectedRequest
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, errNotFound), errors.Is(err, schedule.ErrUnknownHost):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("admin: write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	body := map[string]string{"error": err.Error()}
+	var misdirected *misdirectedError
+	if errors.As(err, &misdirected) {
+		body["owner"] = misdirected.owner
+	}
+	writeJSON(w, code, body)
+}
+
+func newJobID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("job id: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
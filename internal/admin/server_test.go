@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/schedule"
+)
+
+func newTestServer(t *testing.T, owners map[string]string) *httptest.Server {
+	t.Helper()
+	hosts := []config.HostResolved{{Name: "r1", Schedule: "0 0 1 1 *"}}
+	sched := schedule.New(func() []config.HostResolved { return hosts }, func(ctx context.Context, host config.HostResolved) schedule.Result {
+		return schedule.Result{ConfigHash: "sha256:" + host.Name}
+	}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sched.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	for len(sched.States()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	server := New(sched, "secret")
+	server.Route(func(host string) string { return owners[host] })
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, srv *httptest.Server, method, path, token string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestServer(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"r2": "config-pub-1"})
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		wantCode  int
+		wantOwner string
+	}{
+		{name: "health without token", method: http.MethodGet, path: "/healthz", wantCode: http.StatusOK},
+		{name: "no token", method: http.MethodGet, path: "/v1/hosts/r1", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/v1/hosts/r1", token: "guess", wantCode: http.StatusUnauthorized},
+		{name: "own host", method: http.MethodGet, path: "/v1/hosts/r1", token: "secret", wantCode: http.StatusOK},
+		{name: "collect own host", method: http.MethodPost, path: "/v1/collect?host=r1&wait=true", token: "secret", wantCode: http.StatusOK},
+		{name: "other replica's host", method: http.MethodGet, path: "/v1/hosts/r2", token: "secret", wantCode: http.StatusMisdirectedRequest, wantOwner: "config-pub-1"},
+		{name: "collect other replica's host", method: http.MethodPost, path: "/v1/collect?host=r1&host=r2", token: "secret", wantCode: http.StatusMisdirectedRequest, wantOwner: "config-pub-1"},
+		{name: "pause other replica's host", method: http.MethodPost, path: "/v1/hosts/r2/pause", token: "secret", wantCode: http.StatusMisdirectedRequest, wantOwner: "config-pub-1"},
+		{name: "unknown host", method: http.MethodGet, path: "/v1/hosts/r3", token: "secret", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := request(t, srv, tt.method, tt.path, tt.token)
+			if code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %v", code, tt.wantCode, body)
+			}
+			if owner, _ := body["owner"].(string); owner != tt.wantOwner {
+				t.Errorf("owner %q, want %q", owner, tt.wantOwner)
+			}
+		})
+	}
+}
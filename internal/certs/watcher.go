@@ -0,0 +1,316 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+const (
+	KindClient = "client"
+	KindCA     = "ca"
+
+	levelOK       = "ok"
+	levelWarning  = "warning"
+	levelCritical = "critical"
+	levelExpired  = "expired"
+)
+
+// Bundle is the loaded material of one ca/cert/key file set. Generation
+// changes on every reload so connections built from an older bundle can be
+// replaced.
+type Bundle struct {
+	Certificate *tls.Certificate
+	RootCAs     *x509.CertPool
+	Generation  uint64
+}
+
+// Watcher loads TLS files on first use and re-reads them whenever they
+// change on disk, keeping the previous bundle if the new files do not load
+// (for instance a certificate that does not match its key). It also tracks
+// how long every loaded certificate has left and logs when one crosses the
+// warning or critical threshold.
+type Watcher struct {
+	cfg config.CertificatesConfig
+
+	mu         sync.Mutex
+	sets       map[string]*fileSet
+	generation uint64
+}
+
+type fileSet struct {
+	ca, cert, key string
+	bundle        *Bundle
+	stamps        map[string]stamp
+	certs         []*certInfo
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type certInfo struct {
+	file     string
+	kind     string
+	subject  string
+	notAfter time.Time
+	level    string
+}
+
+func NewWatcher(cfg config.CertificatesConfig) *Watcher {
+	return &Watcher{cfg: cfg, sets: map[string]*fileSet{}}
+}
+
+// Get returns the current bundle for the files in tlsCfg, loading them the
+// first time they are asked for.
+func (w *Watcher) Get(tlsCfg config.TLSConfig) (*Bundle, error) {
+	key := tlsCfg.CAFile + "\x00" + tlsCfg.CertFile + "\x00" + tlsCfg.KeyFile
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if set, ok := w.sets[key]; ok {
+		return set.bundle, nil
+	}
+
+	set := &fileSet{ca: tlsCfg.CAFile, cert: tlsCfg.CertFile, key: tlsCfg.KeyFile}
+	if err := w.load(set); err != nil {
+		return nil, err
+	}
+	w.sets[key] = set
+	w.evaluate(set, time.Now())
+	return set.bundle, nil
+}
+
+// Run re-checks every loaded file set each check interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+func (w *Watcher) check(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, set := range w.sets {
+		if set.changed() {
+			if err := w.load(set); err != nil {
+				log.Printf("certificates: reload %s: %v; keeping the previous certificates", set.describe(), err)
+			} else {
+				log.Printf("certificates: reloaded %s", set.describe())
+			}
+		}
+		w.evaluate(set, now)
+	}
+}
+
+// load reads and validates the set's files and swaps in the new bundle only
+// if all of them load.
+func (w *Watcher) load(set *fileSet) error {
+	stamps := map[string]stamp{}
+	for _, path := range []string{set.ca, set.cert, set.key} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		stamps[path] = stamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	bundle := &Bundle{}
+	var infos []*certInfo
+	if set.ca != "" {
+		raw, err := os.ReadFile(set.ca)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+		cas, err := parseCertificates(raw)
+		if err != nil {
+			return fmt.Errorf("CA file %s: %w", set.ca, err)
+		}
+		bundle.RootCAs = x509.NewCertPool()
+		for _, ca := range cas {
+			bundle.RootCAs.AddCert(ca)
+			infos = append(infos, newCertInfo(set.ca, KindCA, ca))
+		}
+	}
+	if set.cert != "" || set.key != "" {
+		cert, err := tls.LoadX509KeyPair(set.cert, set.key)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		leaf := cert.Leaf
+		if leaf == nil {
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return fmt.Errorf("parse client certificate: %w", err)
+			}
+		}
+		bundle.Certificate = &cert
+		infos = append(infos, newCertInfo(set.cert, KindClient, leaf))
+	}
+
+	// Keep the alert level of certificates that did not change so a reload
+	// does not repeat their warnings.
+	previous := map[string]string{}
+	for _, info := range set.certs {
+		previous[info.id()] = info.level
+	}
+	for _, info := range infos {
+		info.level = previous[info.id()]
+	}
+
+	w.generation++
+	bundle.Generation = w.generation
+	set.bundle, set.stamps, set.certs = bundle, stamps, infos
+	return nil
+}
+
+func (set *fileSet) changed() bool {
+	for path, old := range set.stamps {
+		info, err := os.Stat(path)
+		if err != nil {
+			// Mid-rotation the file may be briefly missing; retry next time.
+			continue
+		}
+		if !info.ModTime().Equal(old.modTime) || info.Size() != old.size {
+			return true
+		}
+	}
+	return false
+}
+
+func (set *fileSet) describe() string {
+	var files []string
+	for _, path := range []string{set.ca, set.cert, set.key} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return strings.Join(files, ", ")
+}
+
+// evaluate logs certificates whose alert level changed.
+func (w *Watcher) evaluate(set *fileSet, now time.Time) {
+	for _, info := range set.certs {
+		left := info.notAfter.Sub(now)
+		level := levelOK
+		switch {
+		case left <= 0:
+			level = levelExpired
+		case left <= w.cfg.CriticalBefore:
+			level = levelCritical
+		case left <= w.cfg.WarnBefore:
+			level = levelWarning
+		}
+
+		if level == info.level {
+			continue
+		}
+		first := info.level == ""
+		info.level = level
+		days := int(math.Round(left.Hours() / 24))
+		switch {
+		case level == levelExpired:
+			log.Printf("certificates: %s certificate %q in %s EXPIRED on %s", info.kind, info.subject, info.file, info.notAfter.Format(time.RFC3339))
+		case level != levelOK:
+			log.Printf("certificates: %s: %s certificate %q in %s expires in %d days (%s)", strings.ToUpper(level), info.kind, info.subject, info.file, days, info.notAfter.Format(time.RFC3339))
+		case first:
+			log.Printf("certificates: %s certificate %q in %s expires in %d days", info.kind, info.subject, info.file, days)
+		}
+	}
+}
+
+func newCertInfo(file, kind string, cert *x509.Certificate) *certInfo {
+	return &certInfo{file: file, kind: kind, subject: cert.Subject.String(), notAfter: cert.NotAfter}
+}
+
+func (c *certInfo) id() string {
+	return c.file + "\x00" + c.subject + "\x00" + c.notAfter.String()
+}
+
+func parseCertificates(raw []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// MetricsHandler serves the expiry of every loaded certificate in the
+// Prometheus text format.
+func (w *Watcher) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteMetrics(rw, time.Now())
+	})
+}
+
+func (w *Watcher) WriteMetrics(out io.Writer, now time.Time) {
+	w.mu.Lock()
+	var infos []*certInfo
+	for _, set := range w.sets {
+		infos = append(infos, set.certs...)
+	}
+	w.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].id() < infos[j].id() })
+
+	fmt.Fprintln(out, "# HELP config_pub_certificate_expiry_days Days until the certificate expires; negative once expired.")
+	fmt.Fprintln(out, "# TYPE config_pub_certificate_expiry_days gauge")
+	for _, info := range infos {
+		fmt.Fprintf(out, "config_pub_certificate_expiry_days{%s} %.3f\n", info.labels(), info.notAfter.Sub(now).Hours()/24)
+	}
+	fmt.Fprintln(out, "# HELP config_pub_certificate_not_after_seconds Expiry of the certificate as a Unix timestamp.")
+	fmt.Fprintln(out, "# TYPE config_pub_certificate_not_after_seconds gauge")
+	for _, info := range infos {
+		fmt.Fprintf(out, "config_pub_certificate_not_after_seconds{%s} %d\n", info.labels(), info.notAfter.Unix())
+	}
+}
+
+func (c *certInfo) labels() string {
+	return fmt.Sprintf(`file="%s",kind="%s",subject="%s"`, escapeLabel(c.file), c.kind, escapeLabel(c.subject))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
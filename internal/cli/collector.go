@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/credential"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// ValueType marks updates that carry CLI text rather than a data tree.
+	ValueType = "text"
+
+	// PathPrefix is prepended to the command to form an update's path.
+	PathPrefix = "cli:"
+
+	defaultPort = "22"
+
+	// maxOutput bounds the output of one command, so a misbehaving device
+	// or runaway pager cannot grow memory without limit.
+	maxOutput = 64 << 20
+)
+
+var errOutputTooLarge = fmt.Errorf("output exceeds %d bytes", maxOutput)
+
+// Collector collects hosts over SSH by running CLI commands. Every command's
+// output becomes one text update of the message.
+type Collector struct {
+	creds *credential.Store
+}
+
+func NewCollector() *Collector {
+	return &Collector{creds: credential.NewStore()}
+}
+
+// Collect runs the host's commands, retrying once with fresh credentials
+// if the device rejects them.
+func (c *Collector) Collect(ctx context.Context, host config.HostResolved) (*gnmi.ConfigMessage, error) {
+	var msg *gnmi.ConfigMessage
+	err := c.creds.WithRetry(ctx, host, IsAuthError, func(creds credential.Credentials) error {
+		var err error
+		msg, err = c.collect(ctx, host, creds)
+		return err
+	})
+	return msg, err
+}
+
+// IsAuthError reports whether the SSH server rejected every credential.
+func IsAuthError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// Retain is a no-op: every collection uses its own SSH connection.
+func (c *Collector) Retain(names []string) {}
+
+func (c *Collector) Close() error {
+	return nil
+}
+
+func (c *Collector) collect(ctx context.Context, host config.HostResolved, creds credential.Credentials) (*gnmi.ConfigMessage, error) {
+	var settings config.SSHConfig
+	if host.SSH != nil {
+		settings = *host.SSH
+	}
+	p, err := profile(settings.Platform)
+	if err != nil {
+		return nil, err
+	}
+	commands := p.Commands
+	if len(settings.Commands) > 0 {
+		commands = settings.Commands
+	}
+
+	timeout := host.RequestTimeout
+	if settings.Timeout > 0 {
+		timeout = settings.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	client, err := Dial(ctx, host, settings, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	// Unblock reads and writes when the context ends first.
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	var outputs []string
+	if p.Shell {
+		outputs, err = runShell(ctx, client, p, commands)
+	} else {
+		outputs, err = runExec(client, commands)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ssh %s: %w", host.Name, ctx.Err())
+		}
+		return nil, fmt.Errorf("ssh %s: %w", host.Name, err)
+	}
+
+	msg := &gnmi.ConfigMessage{
+		Timestamp:          time.Now().UTC(),
+		Target:             host.Target,
+		Address:            host.Address,
+		Encoding:           ValueType,
+		Type:               host.Type,
+		CollectionDuration: time.Since(start),
+	}
+	for i, command := range commands {
+		msg.Updates = append(msg.Updates, gnmi.ConfigUpdate{
+			Path:  PathPrefix + command,
+			Value: p.stripVolatile(outputs[i]),
+			Type:  ValueType,
+		})
+	}
+	return msg, nil
+}
+
+// Dial opens an SSH connection to the host with the given settings, checking
+// the host key as described on config.SSHConfig.
+func Dial(ctx context.Context, host config.HostResolved, settings config.SSHConfig, creds credential.Credentials) (*ssh.Client, error) {
+	hostKey, err := hostKeyCallback(host, settings)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := authMethods(settings, creds)
+	if err != nil {
+		return nil, err
+	}
+	clientCfg := &ssh.ClientConfig{
+		User:            creds.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         host.DialTimeout,
+	}
+
+	addr := address(host.Address, settings.Port)
+	dialCtx := ctx
+	if host.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, host.DialTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := dialCtx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientCfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+func hostKeyCallback(host config.HostResolved, settings config.SSHConfig) (ssh.HostKeyCallback, error) {
+	if settings.KnownHosts != "" {
+		callback, err := knownhosts.New(settings.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("known_hosts: %w", err)
+		}
+		return callback, nil
+	}
+	if host.Insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, fmt.Errorf("ssh host %s needs known_hosts or insecure", host.Name)
+}
+
+func authMethods(settings config.SSHConfig, creds credential.Credentials) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if settings.KeyFile != "" {
+		raw, err := os.ReadFile(settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key_file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key_file: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if creds.Password != "" {
+		password := creds.Password
+		methods = append(methods,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		)
+	}
+	return methods, nil
+}
+
+// address uses the configured port, else the address's own port, else 22.
+func address(addr string, port int) string {
+	hostname, addrPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		hostname, addrPort = strings.Trim(addr, "[]"), defaultPort
+	}
+	if port > 0 {
+		addrPort = strconv.Itoa(port)
+	}
+	return net.JoinHostPort(hostname, addrPort)
+}
+
+func runExec(client *ssh.Client, commands []string) ([]string, error) {
+	outputs := make([]string, 0, len(commands))
+	for _, command := range commands {
+		session, err := client.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		// Closing the session on overflow stops the device sending.
+		stdout := &limitedBuffer{max: maxOutput, full: func() { session.Close() }}
+		stderr := &limitedBuffer{max: maxOutput, full: func() { session.Close() }}
+		session.Stdout = stdout
+		session.Stderr = stderr
+		err = session.Run(command)
+		session.Close()
+		if stdout.overflow || stderr.overflow {
+			return nil, fmt.Errorf("%s: %w", command, errOutputTooLarge)
+		}
+		if err != nil {
+			if msg := firstLine(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %w: %s", command, err, msg)
+			}
+			return nil, fmt.Errorf("%s: %w", command, err)
+		}
+		outputs = append(outputs, strings.ReplaceAll(stdout.String(), "\r\n", "\n"))
+	}
+	return outputs, nil
+}
+
+// limitedBuffer is a bytes.Buffer that fails writes past max, calling full
+// once when it does.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	full     func()
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		if !b.overflow {
+			b.overflow = true
+			b.full()
+		}
+		return 0, errOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
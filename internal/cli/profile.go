@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Profile describes how to pull the config from one platform's CLI.
+type Profile struct {
+	Commands []string
+	// Shell runs the commands in an interactive session with a PTY, for
+	// devices whose exec channel is missing or does not page correctly.
+	// Setup runs first in that session, e.g. to turn paging off.
+	Shell bool
+	Setup []string
+	// Prompt matches the device prompt that ends a command's output; More
+	// matches a pager prompt that is answered with a space.
+	Prompt *regexp.Regexp
+	More   *regexp.Regexp
+	// Volatile matches output lines that change without the config
+	// changing, such as timestamps; they are dropped so the config hash
+	// only changes with the config.
+	Volatile []*regexp.Regexp
+}
+
+const DefaultPlatform = "generic"
+
+var (
+	defaultPrompt = regexp.MustCompile(`^[\w.\-@()/:~\[\] ]{1,80}[>#$%]\s*$`)
+	defaultMore   = regexp.MustCompile(`(?i)(-+ ?more ?-+|<--- more --->)\s*$`)
+)
+
+// Volatile lines of the platforms' running-config output.
+var (
+	iosVolatile = volatile(
+		`^Building configuration\.\.\.$`,
+		`^Current configuration : \d+ bytes$`,
+		`^! Last configuration change at `,
+		`^! NVRAM config last updated at `,
+		`^! No configuration change since last restart$`,
+	)
+	// IOS XR prints the time before every command's output.
+	xrVolatile = volatile(
+		`^(Mon|Tue|Wed|Thu|Fri|Sat|Sun) (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d+ \d\d:\d\d:\d\d(\.\d+)? \S+$`,
+		`^Building configuration\.\.\.$`,
+		`^!! Last configuration change at `,
+	)
+	nxosVolatile = volatile(
+		`^!Time: `,
+		`^!Running configuration last done at: `,
+	)
+	eosVolatile = volatile(
+		`^! Startup-config last modified at `,
+	)
+	junosVolatile = volatile(
+		`^## Last (commit|changed): `,
+	)
+)
+
+var Profiles = map[string]Profile{
+	"generic": {
+		Commands: []string{"show running-config"},
+		Volatile: iosVolatile,
+	},
+	"frr": {
+		Commands: []string{"vtysh -c 'show running-config'"},
+		Volatile: iosVolatile,
+	},
+	"juniper_junos": {
+		Commands: []string{"show configuration | display set | no-more"},
+		Volatile: junosVolatile,
+	},
+	"cisco_ios": {
+		Commands: []string{"show running-config"},
+		Shell:    true,
+		Setup:    []string{"terminal length 0", "terminal width 511"},
+		Volatile: iosVolatile,
+	},
+	"cisco_xr": {
+		Commands: []string{"show running-config"},
+		Shell:    true,
+		Setup:    []string{"terminal length 0", "terminal width 0"},
+		Volatile: xrVolatile,
+	},
+	"cisco_nxos": {
+		Commands: []string{"show running-config"},
+		Shell:    true,
+		Setup:    []string{"terminal length 0", "terminal width 511"},
+		Volatile: nxosVolatile,
+	},
+	"arista_eos": {
+		Commands: []string{"show running-config"},
+		Shell:    true,
+		Setup:    []string{"terminal length 0", "terminal width 32767"},
+		Volatile: eosVolatile,
+	},
+}
+
+func volatile(exprs ...string) []*regexp.Regexp {
+	out := make([]*regexp.Regexp, len(exprs))
+	for i, expr := range exprs {
+		out[i] = regexp.MustCompile(expr)
+	}
+	return out
+}
+
+func profile(platform string) (Profile, error) {
+	if platform == "" {
+		platform = DefaultPlatform
+	}
+	p, ok := Profiles[platform]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown ssh platform %q", platform)
+	}
+	if p.Prompt == nil {
+		p.Prompt = defaultPrompt
+	}
+	if p.More == nil {
+		p.More = defaultMore
+	}
+	return p, nil
+}
+
+// stripVolatile drops the output lines matching the profile's Volatile
+// patterns.
+func (p Profile) stripVolatile(output string) string {
+	if len(p.Volatile) == 0 {
+		return output
+	}
+	lines := strings.SplitAfter(output, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		text := strings.TrimRight(line, "\r\n")
+		if !slices.ContainsFunc(p.Volatile, func(re *regexp.Regexp) bool { return re.MatchString(text) }) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
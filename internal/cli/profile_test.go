@@ -0,0 +1,45 @@
+package cli
+
+import "testing"
+
+func TestStripVolatile(t *testing.T) {
+	tests := []struct {
+		platform string
+		output   string
+		want     string
+	}{
+		{
+			platform: "cisco_xr",
+			output:   "Fri Oct 16 09:12:44.123 UTC\r\nBuilding configuration...\r\n!! IOS XR Configuration 7.11.1\r\n!! Last configuration change at Thu Oct 15 18:02:11 2026 by admin\r\n!\r\nhostname xrd1\r\n",
+			want:     "!! IOS XR Configuration 7.11.1\r\n!\r\nhostname xrd1\r\n",
+		},
+		{
+			platform: "cisco_ios",
+			output:   "Building configuration...\n\nCurrent configuration : 1843 bytes\n!\n! Last configuration change at 18:02:11 UTC Thu Oct 15 2026\n!\nversion 17.9\nhostname r1\n",
+			want:     "\n!\n!\nversion 17.9\nhostname r1\n",
+		},
+		{
+			platform: "cisco_nxos",
+			output:   "!Command: show running-config\n!Running configuration last done at: Thu Oct 15 18:02:11 2026\n!Time: Fri Oct 16 09:12:44 2026\n\nversion 10.3(4a)\nhostname n1\n",
+			want:     "!Command: show running-config\n\nversion 10.3(4a)\nhostname n1\n",
+		},
+		{
+			// Only whole lines are matched; config that mentions a
+			// timestamp is kept.
+			platform: "cisco_ios",
+			output:   "banner motd ^Building configuration...^\nhostname r1",
+			want:     "banner motd ^Building configuration...^\nhostname r1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			p, err := profile(tt.platform)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.stripVolatile(tt.output); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ansi matches the terminal escape sequences devices use to redraw lines,
+// e.g. when erasing a pager prompt.
+var ansi = regexp.MustCompile(`\x1b(\[[0-9;?]*[A-Za-z]|[()][A-Z0-9]|[=>])`)
+
+// shell drives an interactive session: it writes a command and reads until
+// the device prompt comes back, answering pager prompts on the way.
+type shell struct {
+	in      io.Writer
+	out     <-chan []byte
+	profile Profile
+
+	// prompt is the first prompt seen; later output only ends on it, so
+	// config lines that happen to look like a prompt do not.
+	prompt  string
+	partial []byte
+}
+
+func runShell(ctx context.Context, client *ssh.Client, p Profile, commands []string) ([]string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	// A wide terminal keeps devices from wrapping long lines.
+	if err := session.RequestPty("vt100", 0, 511, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+		return nil, fmt.Errorf("request pty: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Shell(); err != nil {
+		return nil, fmt.Errorf("start shell: %w", err)
+	}
+
+	out := make(chan []byte, 16)
+	go func() {
+		defer close(out)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				select {
+				case out <- buf[:n]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s := &shell{in: stdin, out: out, profile: p}
+	if _, err := s.read(ctx); err != nil {
+		return nil, fmt.Errorf("waiting for prompt: %w", err)
+	}
+	for _, command := range p.Setup {
+		if _, err := s.run(ctx, command); err != nil {
+			return nil, err
+		}
+	}
+	outputs := make([]string, 0, len(commands))
+	for _, command := range commands {
+		output, err := s.run(ctx, command)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	io.WriteString(stdin, "exit\n")
+	return outputs, nil
+}
+
+func (s *shell) run(ctx context.Context, command string) (string, error) {
+	if _, err := io.WriteString(s.in, command+"\n"); err != nil {
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+	lines, err := s.read(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+	// Drop the echoed command line.
+	if len(lines) > 0 && strings.HasSuffix(strings.TrimSpace(lines[0]), command) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// read collects output lines until the prompt, failing once more than
+// maxOutput bytes arrive. Only the unterminated last line can be a prompt,
+// so complete lines are cleaned and kept as they come.
+func (s *shell) read(ctx context.Context) ([]string, error) {
+	var lines []string
+	received := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case chunk, ok := <-s.out:
+			if !ok {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if received += len(chunk); received > maxOutput {
+				return nil, errOutputTooLarge
+			}
+			s.partial = append(s.partial, chunk...)
+		}
+
+		if i := strings.LastIndexByte(string(s.partial), '\n'); i >= 0 {
+			for _, line := range strings.Split(string(s.partial[:i]), "\n") {
+				lines = append(lines, cleanLine(line))
+			}
+			s.partial = append([]byte(nil), s.partial[i+1:]...)
+		}
+
+		last := cleanLine(string(s.partial))
+		switch {
+		case s.profile.More.MatchString(last):
+			s.partial = nil
+			if _, err := io.WriteString(s.in, " "); err != nil {
+				return nil, err
+			}
+		case s.isPrompt(last):
+			s.partial = nil
+			return lines, nil
+		}
+	}
+}
+
+func (s *shell) isPrompt(line string) bool {
+	line = strings.TrimSpace(line)
+	if s.prompt == "" {
+		if !s.profile.Prompt.MatchString(line) {
+			return false
+		}
+		s.prompt = line
+		return true
+	}
+	return line == s.prompt
+}
+
+// cleanLine strips escape sequences and carriage returns and applies
+// backspaces the way a terminal would.
+func cleanLine(line string) string {
+	line = ansi.ReplaceAllString(line, "")
+	out := make([]rune, 0, len(line))
+	for _, r := range line {
+		switch r {
+		case '\r':
+		case '\b':
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, r)
+		}
+	}
+	return strings.TrimRight(string(out), " \t")
+}
@@ -0,0 +1,72 @@
+package collect
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+const (
+	ProtocolGNMI    = "gnmi"
+	ProtocolSSH     = "ssh"
+	ProtocolNETCONF = "netconf"
+)
+
+// Collector fetches one host's config as a message for the publisher.
+type Collector interface {
+	Collect(ctx context.Context, host config.HostResolved) (*gnmi.ConfigMessage, error)
+	// Retain drops per-host state for hosts that are no longer in the
+	// inventory.
+	Retain(names []string)
+	Close() error
+}
+
+// Mux hands each host to the collector for its protocol; hosts without a
+// protocol use gNMI.
+type Mux struct {
+	backends map[string]Collector
+}
+
+func NewMux(backends map[string]Collector) *Mux {
+	return &Mux{backends: backends}
+}
+
+func (m *Mux) Collect(ctx context.Context, host config.HostResolved) (*gnmi.ConfigMessage, error) {
+	protocol := host.Protocol
+	if protocol == "" {
+		protocol = ProtocolGNMI
+	}
+	backend, ok := m.backends[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+	return backend.Collect(ctx, host)
+}
+
+func (m *Mux) Retain(names []string) {
+	for _, backend := range m.backends {
+		backend.Retain(names)
+	}
+}
+
+func (m *Mux) Close() error {
+	var first error
+	for _, protocol := range m.protocols() {
+		if err := m.backends[protocol].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m *Mux) protocols() []string {
+	protocols := make([]string, 0, len(m.backends))
+	for protocol := range m.backends {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	return protocols
+}
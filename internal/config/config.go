@@ -2,74 +2,343 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Kafka    KafkaConfig   `yaml:"kafka"`
-	GNMI     GNMIConfig    `yaml:"gnmi"`
-	Hosts    []Host        `yaml:"hosts"`
-	Interval time.Duration `yaml:"interval"`
-	RunOnce  bool          `yaml:"run_once"`
+	Kafka        KafkaConfig        `yaml:"kafka"`
+	GNMI         GNMIConfig         `yaml:"gnmi"`
+	Hosts        []Host             `yaml:"hosts"`
+	Groups       map[string]Group   `yaml:"groups"`
+	Inventory    InventoryConfig    `yaml:"inventory"`
+	Admin        AdminConfig        `yaml:"admin"`
+	Syslog       *SyslogConfig      `yaml:"syslog"`
+	Coordination CoordinationConfig `yaml:"coordination"`
+	Certificates CertificatesConfig `yaml:"certificates"`
+	Interval     time.Duration      `yaml:"interval"`
+	Schedule     string             `yaml:"schedule"`
+	Jitter       time.Duration      `yaml:"jitter"`
+	Blackouts    []Blackout         `yaml:"blackouts"`
+	Concurrency  int                `yaml:"concurrency"`
+	RunOnce      bool               `yaml:"run_once"`
+}
+
+// Blackout suppresses collection for Duration after each activation of the
+// cron expression, e.g. "0 22 * * 6" with 6h for Saturday 22:00-04:00.
+type Blackout struct {
+	Cron     string        `yaml:"cron"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// AdminConfig enables the admin HTTP API when Listen is set. Token, if set,
+// is required as a bearer token; ADMIN_TOKEN overrides it. Only a loopback
+// Listen address may go without a token.
+type AdminConfig struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"`
+}
+
+// SyslogConfig enables the syslog listener that triggers a collection when a
+// host reports a config commit. Patterns maps a vendor to regular expressions
+// matched against the raw message and replaces that vendor's built-in
+// patterns; an empty list disables the vendor. Sources maps sender IPs to
+// host names for devices that log from an address other than the one they
+// are collected on.
+type SyslogConfig struct {
+	UDP      string              `yaml:"udp"`
+	TCP      string              `yaml:"tcp"`
+	Debounce time.Duration       `yaml:"debounce"`
+	Patterns map[string][]string `yaml:"patterns"`
+	Sources  map[string]string   `yaml:"sources"`
+}
+
+// CoordinationConfig lets several replicas share the host list. Mode is
+// "leader" (one active replica) or "shard" (hosts spread over all replicas);
+// empty disables coordination. Backend is "kubernetes" (Lease objects) or
+// "file" (lease files in Dir). Identity defaults to POD_NAME, then the
+// hostname.
+type CoordinationConfig struct {
+	Mode      string        `yaml:"mode"`
+	Backend   string        `yaml:"backend"`
+	Identity  string        `yaml:"identity"`
+	Lease     string        `yaml:"lease"`
+	Namespace string        `yaml:"namespace"`
+	Dir       string        `yaml:"dir"`
+	TTL       time.Duration `yaml:"ttl"`
+	Renew     time.Duration `yaml:"renew"`
+}
+
+// CertificatesConfig controls how often TLS files are checked for changes
+// and when an approaching expiry is logged as a warning or as critical.
+type CertificatesConfig struct {
+	CheckInterval  time.Duration `yaml:"check_interval"`
+	WarnBefore     time.Duration `yaml:"warn_before"`
+	CriticalBefore time.Duration `yaml:"critical_before"`
+}
+
+type InventoryConfig struct {
+	Refresh time.Duration          `yaml:"refresh"`
+	Arango  *ArangoInventoryConfig `yaml:"arango"`
+	Files   *FileInventoryConfig   `yaml:"files"`
+	HTTP    *HTTPInventoryConfig   `yaml:"http"`
+}
+
+// FileInventoryConfig reads every *.yaml, *.yml and *.csv file in Dir.
+type FileInventoryConfig struct {
+	Dir      string `yaml:"dir"`
+	Port     int    `yaml:"port"`
+	Defaults Host   `yaml:"defaults"`
+}
+
+// HTTPInventoryConfig fetches hosts from a JSON endpoint. Items is the dotted
+// path to the host list in the response (empty for a top-level list or a
+// "hosts" key). Fields maps host fields (name, address, target, groups, tags)
+// to dotted paths within each item; "[]" after a segment maps over a list,
+// e.g. "tags[].slug". Without Fields, items are decoded as hosts directly.
+type HTTPInventoryConfig struct {
+	URL      string            `yaml:"url"`
+	Headers  map[string]string `yaml:"headers"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Items    string            `yaml:"items"`
+	Fields   map[string]string `yaml:"fields"`
+	Port     int               `yaml:"port"`
+	Defaults Host              `yaml:"defaults"`
+}
+
+// ArangoInventoryConfig discovers hosts from Jalapeno's node collections.
+// Filter is an AQL boolean expression over the document variable n.
+// AddressFrom names the attribute (dotted for nested) holding the address to
+// dial; Port is appended when that address has none. Defaults supplies the
+// remaining host settings for every discovered node.
+type ArangoInventoryConfig struct {
+	ArangoConfig `yaml:",inline"`
+	Collections  []string `yaml:"collections"`
+	Filter       string   `yaml:"filter"`
+	NameFrom     string   `yaml:"name_from"`
+	AddressFrom  string   `yaml:"address_from"`
+	Port         int      `yaml:"port"`
+	Defaults     Host     `yaml:"defaults"`
+}
+
+// ArangoConfig is how config-pub and config-ingest reach Arango. Endpoints
+// are further coordinators to fail over to; Auth is basic, jwt, token or
+// none.
+type ArangoConfig struct {
+	URL       string        `yaml:"url"`
+	Endpoints []string      `yaml:"endpoints"`
+	Database  string        `yaml:"database"`
+	User      string        `yaml:"user"`
+	Password  string        `yaml:"password"`
+	UserFile  string        `yaml:"user_file"`
+	PassFile  string        `yaml:"pass_file"`
+	Auth      string        `yaml:"auth"`
+	TokenFile string        `yaml:"token_file"`
+	TLS       TLSConfig     `yaml:"tls"`
+	Timeout   time.Duration `yaml:"timeout"`
 }
 
 type KafkaConfig struct {
-	Brokers                []string      `yaml:"brokers"`
-	Topic                  string        `yaml:"topic"`
-	CreateTopic            bool          `yaml:"create_topic"`
-	TopicPartitions        int           `yaml:"topic_partitions"`
-	TopicReplicationFactor int           `yaml:"topic_replication_factor"`
-	BatchTimeout           time.Duration `yaml:"batch_timeout"`
-	RequiredAcks           string        `yaml:"required_acks"`
-	MaxMessageSize         int           `yaml:"max_message_size"`
+	Brokers                []string             `yaml:"brokers"`
+	Topic                  string               `yaml:"topic"`
+	CreateTopic            bool                 `yaml:"create_topic"`
+	TopicPartitions        int                  `yaml:"topic_partitions"`
+	TopicReplicationFactor int                  `yaml:"topic_replication_factor"`
+	BatchTimeout           time.Duration        `yaml:"batch_timeout"`
+	RequiredAcks           string               `yaml:"required_acks"`
+	MaxMessageSize         int                  `yaml:"max_message_size"`
+	Compression            string               `yaml:"compression"`
+	PayloadEncoding        string               `yaml:"payload_encoding"`
+	CompressOversize       bool                 `yaml:"compress_oversize"`
+	ChunkOversize          bool                 `yaml:"chunk_oversize"`
+	Format                 string               `yaml:"format"`
+	SchemaRegistry         SchemaRegistryConfig `yaml:"schema_registry"`
+}
+
+type SchemaRegistryConfig struct {
+	URL      string        `yaml:"url"`
+	Subject  string        `yaml:"subject"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"`
 }
 
 type GNMIConfig struct {
-	Username       string        `yaml:"username"`
-	Password       string        `yaml:"password"`
-	DialTimeout    time.Duration `yaml:"dial_timeout"`
-	RequestTimeout time.Duration `yaml:"request_timeout"`
-	Insecure       bool          `yaml:"insecure"`
-	Encoding       string        `yaml:"encoding"`
-	Paths          []string      `yaml:"paths"`
-	Type           string        `yaml:"type"`
-	TLS            TLSConfig     `yaml:"tls"`
+	Username       string             `yaml:"username"`
+	Password       string             `yaml:"password"`
+	Credentials    *CredentialsConfig `yaml:"credentials"`
+	Auth           *AuthConfig        `yaml:"auth"`
+	DialTimeout    time.Duration      `yaml:"dial_timeout"`
+	RequestTimeout time.Duration      `yaml:"request_timeout"`
+	Keepalive      Keepalive          `yaml:"keepalive"`
+	MaxRecvMsgSize int                `yaml:"max_recv_msg_size"`
+	Insecure       bool               `yaml:"insecure"`
+	Encoding       string             `yaml:"encoding"`
+	Paths          []string           `yaml:"paths"`
+	Type           string             `yaml:"type"`
+	Strategy       string             `yaml:"strategy"`
+	ExpandRoot     bool               `yaml:"expand_root"`
+	ModelFilter    string             `yaml:"model_filter"`
+	TLS            TLSConfig          `yaml:"tls"`
+}
+
+// CredentialsConfig fetches the username and password from outside the
+// config file. UserFile and PassFile are read on use (a trailing newline is
+// dropped). Exec runs a command that prints {"username": ..., "password": ...}
+// or the username and password on two lines. Anything it does not supply
+// falls back to the plain username and password, in which ${VAR} references
+// are expanded from the environment. Results are cached for Cache.
+type CredentialsConfig struct {
+	UserFile string        `yaml:"user_file"`
+	PassFile string        `yaml:"pass_file"`
+	Exec     []string      `yaml:"exec"`
+	Cache    time.Duration `yaml:"cache"`
+}
+
+// AuthConfig selects the per-RPC credentials sent to a target. Mode is
+// "basic" (username/password metadata, the default when either is set),
+// "token" (a bearer token, static or read from TokenFile whenever it
+// changes), "oauth2" (client-credentials grant), "mtls" (client certificate
+// only, no metadata) or "none".
+type AuthConfig struct {
+	Mode      string       `yaml:"mode"`
+	Token     string       `yaml:"token"`
+	TokenFile string       `yaml:"token_file"`
+	OAuth2    OAuth2Config `yaml:"oauth2"`
+}
+
+// OAuth2Config fetches access tokens from TokenURL with the client-credentials
+// grant; the client authenticates with HTTP basic auth. Params are added to
+// the token request, e.g. an audience.
+type OAuth2Config struct {
+	TokenURL         string            `yaml:"token_url"`
+	ClientID         string            `yaml:"client_id"`
+	ClientSecret     string            `yaml:"client_secret"`
+	ClientSecretFile string            `yaml:"client_secret_file"`
+	Scopes           []string          `yaml:"scopes"`
+	Params           map[string]string `yaml:"params"`
+}
+
+// SSHConfig collects a host through its CLI over SSH. Platform selects a
+// built-in profile for commands, paging and prompts; Commands replaces the
+// profile's commands. The host key is checked against KnownHosts; without
+// it, only insecure hosts are accepted, unverified. Port defaults to the
+// address port, else 22.
+type SSHConfig struct {
+	Platform   string        `yaml:"platform"`
+	Port       int           `yaml:"port"`
+	Commands   []string      `yaml:"commands"`
+	KeyFile    string        `yaml:"key_file"`
+	KnownHosts string        `yaml:"known_hosts"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// NetconfConfig collects a host with NETCONF <get-config> over SSH, one
+// request per path. Filter is "subtree" (default) or "xpath". Namespaces adds
+// module namespaces the server does not announce in its hello. Port defaults
+// to 830; host keys are checked as for SSHConfig.
+type NetconfConfig struct {
+	Port       int               `yaml:"port"`
+	Filter     string            `yaml:"filter"`
+	Namespaces map[string]string `yaml:"namespaces"`
+	KeyFile    string            `yaml:"key_file"`
+	KnownHosts string            `yaml:"known_hosts"`
+	Timeout    time.Duration     `yaml:"timeout"`
+}
+
+type Keepalive struct {
+	Time    time.Duration `yaml:"time"`
+	Timeout time.Duration `yaml:"timeout"`
 }
 
+// TLSConfig for a target. ServerName overrides the name verified against the
+// certificate (default: the address host); MinVersion is "1.2" or "1.3".
 type TLSConfig struct {
 	CAFile             string `yaml:"ca_file"`
 	CertFile           string `yaml:"cert_file"`
 	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	MinVersion         string `yaml:"min_version"`
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 type Host struct {
-	Name     string     `yaml:"name"`
-	Address  string     `yaml:"address"`
-	Target   string     `yaml:"target"`
-	Username string     `yaml:"username"`
-	Password string     `yaml:"password"`
-	Insecure *bool      `yaml:"insecure"`
-	Paths    []string   `yaml:"paths"`
-	Type     string     `yaml:"type"`
-	TLS      *TLSConfig `yaml:"tls"`
+	Name         string   `yaml:"name"`
+	Address      string   `yaml:"address"`
+	Target       string   `yaml:"target"`
+	Groups       []string `yaml:"groups"`
+	Tags         []string `yaml:"tags"`
+	HostSettings `yaml:",inline"`
+	// DefaultPort, set by inventory providers, is appended by Resolve to an
+	// address without a port when the host is collected over gNMI. Other
+	// protocols have their own port settings.
+	DefaultPort int `yaml:"-"`
+}
+
+// Group settings apply to every host that lists the group or carries one of
+// its tags.
+type Group struct {
+	Tags         []string `yaml:"tags"`
+	HostSettings `yaml:",inline"`
+}
+
+// HostSettings are the overrides a host or group can set over the global
+// gNMI defaults.
+type HostSettings struct {
+	Protocol    string             `yaml:"protocol"`
+	SSH         *SSHConfig         `yaml:"ssh"`
+	Netconf     *NetconfConfig     `yaml:"netconf"`
+	Username    string             `yaml:"username"`
+	Password    string             `yaml:"password"`
+	Credentials *CredentialsConfig `yaml:"credentials"`
+	Auth        *AuthConfig        `yaml:"auth"`
+	Insecure    *bool              `yaml:"insecure"`
+	Paths       []string           `yaml:"paths"`
+	Type        string             `yaml:"type"`
+	Strategy    string             `yaml:"strategy"`
+	TLS         *TLSConfig         `yaml:"tls"`
+	Interval    time.Duration      `yaml:"interval"`
+	Schedule    string             `yaml:"schedule"`
+	Jitter      time.Duration      `yaml:"jitter"`
+	Blackouts   []Blackout         `yaml:"blackouts"`
 }
 
 type HostResolved struct {
 	Name           string
 	Address        string
 	Target         string
+	Groups         []string
+	Tags           []string
+	Protocol       string
+	SSH            *SSHConfig
+	Netconf        *NetconfConfig
 	Username       string
 	Password       string
+	Credentials    *CredentialsConfig
+	Auth           *AuthConfig
 	Insecure       bool
 	Paths          []string
 	Type           string
+	Strategy       string
+	ExpandRoot     bool
+	ModelFilter    string
 	Encoding       string
 	DialTimeout    time.Duration
 	RequestTimeout time.Duration
+	Keepalive      Keepalive
+	MaxRecvMsgSize int
+	Interval       time.Duration
+	Schedule       string
+	Jitter         time.Duration
+	Blackouts      []Blackout
 	TLS            TLSConfig
 }
 
@@ -86,9 +355,18 @@ func Load(path string) (*Config, error) {
 
 	cfg.Kafka.applyDefaults()
 	cfg.GNMI.applyDefaults()
+	cfg.Inventory.applyDefaults()
+	if cfg.Syslog != nil {
+		cfg.Syslog.applyDefaults()
+	}
+	cfg.Coordination.applyDefaults()
+	cfg.Certificates.applyDefaults()
 	if cfg.Interval == 0 {
 		cfg.Interval = 5 * time.Minute
 	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 4
+	}
 
 	if v := os.Getenv("GNMI_USERNAME"); v != "" {
 		cfg.GNMI.Username = v
@@ -96,20 +374,81 @@ func Load(path string) (*Config, error) {
 	if v := os.Getenv("GNMI_PASSWORD"); v != "" {
 		cfg.GNMI.Password = v
 	}
+	if v := os.Getenv("ADMIN_TOKEN"); v != "" {
+		cfg.Admin.Token = v
+	}
 
-	if len(cfg.Hosts) == 0 {
+	if err := cfg.Admin.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Coordination.Mode != "" && cfg.Coordination.Renew >= cfg.Coordination.TTL {
+		return nil, fmt.Errorf("coordination renew (%s) must be shorter than ttl (%s)", cfg.Coordination.Renew, cfg.Coordination.TTL)
+	}
+
+	if len(cfg.Hosts) == 0 && !cfg.Inventory.Dynamic() {
 		return nil, errors.New("no hosts configured")
 	}
 
+	global := HostSettings{Schedule: cfg.Schedule, Blackouts: cfg.Blackouts}
+	if err := global.validateSchedule(); err != nil {
+		return nil, err
+	}
+	for name, group := range cfg.Groups {
+		if err := group.validateSchedule(); err != nil {
+			return nil, fmt.Errorf("group %s: %w", name, err)
+		}
+	}
+
 	for i := range cfg.Hosts {
 		if cfg.Hosts[i].Name == "" {
 			cfg.Hosts[i].Name = cfg.Hosts[i].Address
 		}
+		if err := cfg.Hosts[i].validateSchedule(); err != nil {
+			return nil, fmt.Errorf("host %s: %w", cfg.Hosts[i].Name, err)
+		}
+		for _, group := range cfg.Hosts[i].Groups {
+			if _, ok := cfg.Groups[group]; !ok {
+				return nil, fmt.Errorf("host %s: unknown group %q", cfg.Hosts[i].Name, group)
+			}
+		}
 	}
 
 	return &cfg, nil
 }
 
+// validate refuses an admin API reachable from other machines without a
+// token: it can trigger collections and pause hosts.
+func (a AdminConfig) validate() error {
+	if a.Listen == "" || a.Token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(a.Listen)
+	if err != nil {
+		return fmt.Errorf("admin listen %q: %w", a.Listen, err)
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("admin listen %q is not a loopback address: set admin.token or ADMIN_TOKEN", a.Listen)
+}
+
+func (s HostSettings) validateSchedule() error {
+	if s.Schedule != "" {
+		if _, err := cron.ParseStandard(s.Schedule); err != nil {
+			return fmt.Errorf("schedule %q: %w", s.Schedule, err)
+		}
+	}
+	for _, b := range s.Blackouts {
+		if _, err := cron.ParseStandard(b.Cron); err != nil {
+			return fmt.Errorf("blackout %q: %w", b.Cron, err)
+		}
+		if b.Duration <= 0 {
+			return fmt.Errorf("blackout %q: duration must be positive", b.Cron)
+		}
+	}
+	return nil
+}
+
 func (k *KafkaConfig) applyDefaults() {
 	if k.BatchTimeout == 0 {
 		k.BatchTimeout = 500 * time.Millisecond
@@ -120,6 +459,15 @@ func (k *KafkaConfig) applyDefaults() {
 	if k.MaxMessageSize == 0 {
 		k.MaxMessageSize = 5 * 1024 * 1024
 	}
+	if k.Format == "" {
+		k.Format = "json"
+	}
+	if k.SchemaRegistry.Subject == "" && k.Topic != "" {
+		k.SchemaRegistry.Subject = k.Topic + "-value"
+	}
+	if k.PayloadEncoding == "" {
+		k.PayloadEncoding = "identity"
+	}
 	if k.TopicPartitions == 0 {
 		k.TopicPartitions = 1
 	}
@@ -128,6 +476,82 @@ func (k *KafkaConfig) applyDefaults() {
 	}
 }
 
+func (c *CertificatesConfig) applyDefaults() {
+	if c.CheckInterval == 0 {
+		c.CheckInterval = time.Minute
+	}
+	if c.WarnBefore == 0 {
+		c.WarnBefore = 30 * 24 * time.Hour
+	}
+	if c.CriticalBefore == 0 {
+		c.CriticalBefore = 7 * 24 * time.Hour
+	}
+}
+
+func (c *CoordinationConfig) applyDefaults() {
+	if c.Backend == "" {
+		c.Backend = "kubernetes"
+	}
+	if c.Identity == "" {
+		c.Identity = os.Getenv("POD_NAME")
+	}
+	if c.Lease == "" {
+		c.Lease = "config-pub"
+	}
+	if c.TTL == 0 {
+		c.TTL = 15 * time.Second
+	}
+	if c.Renew == 0 {
+		c.Renew = 5 * time.Second
+	}
+}
+
+func (s *SyslogConfig) applyDefaults() {
+	if s.UDP == "" && s.TCP == "" {
+		s.UDP = ":514"
+	}
+	if s.Debounce == 0 {
+		s.Debounce = 5 * time.Second
+	}
+}
+
+func (i *InventoryConfig) applyDefaults() {
+	if i.Refresh == 0 {
+		i.Refresh = 5 * time.Minute
+	}
+	if a := i.Arango; a != nil {
+		if len(a.Collections) == 0 {
+			a.Collections = []string{"igp_node", "bgp_node"}
+		}
+		if a.NameFrom == "" {
+			a.NameFrom = "name"
+		}
+		if a.AddressFrom == "" {
+			a.AddressFrom = "router_id"
+		}
+		if a.Port == 0 {
+			a.Port = 57400
+		}
+	}
+	if f := i.Files; f != nil && f.Port == 0 {
+		f.Port = 57400
+	}
+	if h := i.HTTP; h != nil {
+		if h.Port == 0 {
+			h.Port = 57400
+		}
+		if h.Timeout == 0 {
+			h.Timeout = 30 * time.Second
+		}
+	}
+}
+
+// Dynamic reports whether any inventory provider besides the static host
+// list is configured.
+func (i InventoryConfig) Dynamic() bool {
+	return i.Arango != nil || i.Files != nil || i.HTTP != nil
+}
+
 func (g *GNMIConfig) applyDefaults() {
 	if g.DialTimeout == 0 {
 		g.DialTimeout = 10 * time.Second
@@ -135,50 +559,96 @@ func (g *GNMIConfig) applyDefaults() {
 	if g.RequestTimeout == 0 {
 		g.RequestTimeout = 20 * time.Second
 	}
+	if g.Keepalive.Time == 0 {
+		g.Keepalive.Time = 30 * time.Second
+	}
+	if g.Keepalive.Timeout == 0 {
+		g.Keepalive.Timeout = 10 * time.Second
+	}
 	if g.Encoding == "" {
 		g.Encoding = "json_ietf"
 	}
 	if g.Type == "" {
 		g.Type = "config"
 	}
+	if g.Strategy == "" {
+		g.Strategy = "single"
+	}
+}
+
+// GroupsFor lists the groups a host belongs to: the ones it names, in order,
+// followed by any group whose tags it carries, sorted by group name.
+func (c *Config) GroupsFor(h Host) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, name := range h.Groups {
+		if _, ok := c.Groups[name]; ok && !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+
+	tagged := []string{}
+	for name, group := range c.Groups {
+		if seen[name] {
+			continue
+		}
+		for _, tag := range group.Tags {
+			if slices.Contains(h.Tags, tag) {
+				tagged = append(tagged, name)
+				break
+			}
+		}
+	}
+	sort.Strings(tagged)
+	return append(out, tagged...)
 }
 
-func (h Host) Resolve(global GNMIConfig) HostResolved {
+// Resolve merges the host's settings with its groups and the global gNMI
+// defaults. Host settings win, then groups in GroupsFor order, then global.
+func (h Host) Resolve(cfg *Config) HostResolved {
+	global := cfg.GNMI
+	groups := cfg.GroupsFor(h)
 	resolved := HostResolved{
 		Name:           h.Name,
 		Address:        h.Address,
 		Target:         h.Target,
-		Username:       h.Username,
-		Password:       h.Password,
+		Groups:         groups,
+		Tags:           h.Tags,
+		Username:       global.Username,
+		Password:       global.Password,
+		Credentials:    global.Credentials,
+		Auth:           global.Auth,
 		Insecure:       global.Insecure,
-		Paths:          h.Paths,
-		Type:           h.Type,
+		Paths:          global.Paths,
+		Type:           global.Type,
+		Strategy:       global.Strategy,
+		ExpandRoot:     global.ExpandRoot,
+		ModelFilter:    global.ModelFilter,
 		Encoding:       global.Encoding,
 		DialTimeout:    global.DialTimeout,
 		RequestTimeout: global.RequestTimeout,
+		Keepalive:      global.Keepalive,
+		MaxRecvMsgSize: global.MaxRecvMsgSize,
+		Interval:       cfg.Interval,
+		Schedule:       cfg.Schedule,
+		Jitter:         cfg.Jitter,
+		Blackouts:      cfg.Blackouts,
 		TLS:            global.TLS,
 	}
 
-	if resolved.Username == "" {
-		resolved.Username = global.Username
-	}
-	if resolved.Password == "" {
-		resolved.Password = global.Password
+	for i := len(groups) - 1; i >= 0; i-- {
+		resolved.apply(cfg.Groups[groups[i]].HostSettings)
 	}
+	resolved.apply(h.HostSettings)
+
 	if resolved.Target == "" {
 		resolved.Target = h.Name
 	}
-	if h.Insecure != nil {
-		resolved.Insecure = *h.Insecure
-	}
-	if h.TLS != nil {
-		resolved.TLS = *h.TLS
-	}
-	if len(resolved.Paths) == 0 {
-		resolved.Paths = global.Paths
-	}
-	if resolved.Type == "" {
-		resolved.Type = global.Type
+	if h.DefaultPort > 0 && (resolved.Protocol == "" || resolved.Protocol == "gnmi") {
+		if _, _, err := net.SplitHostPort(resolved.Address); err != nil {
+			resolved.Address = net.JoinHostPort(resolved.Address, strconv.Itoa(h.DefaultPort))
+		}
 	}
 	if len(resolved.Paths) == 0 {
 		resolved.Paths = []string{"/"}
@@ -186,3 +656,55 @@ func (h Host) Resolve(global GNMIConfig) HostResolved {
 
 	return resolved
 }
+
+func (r *HostResolved) apply(s HostSettings) {
+	if s.Protocol != "" {
+		r.Protocol = s.Protocol
+	}
+	if s.SSH != nil {
+		r.SSH = s.SSH
+	}
+	if s.Netconf != nil {
+		r.Netconf = s.Netconf
+	}
+	if s.Username != "" {
+		r.Username = s.Username
+	}
+	if s.Password != "" {
+		r.Password = s.Password
+	}
+	if s.Credentials != nil {
+		r.Credentials = s.Credentials
+	}
+	if s.Auth != nil {
+		r.Auth = s.Auth
+	}
+	if s.Insecure != nil {
+		r.Insecure = *s.Insecure
+	}
+	if len(s.Paths) > 0 {
+		r.Paths = s.Paths
+	}
+	if s.Type != "" {
+		r.Type = s.Type
+	}
+	if s.Strategy != "" {
+		r.Strategy = s.Strategy
+	}
+	if s.TLS != nil {
+		r.TLS = *s.TLS
+	}
+	// Interval and schedule are one setting: a level that sets either
+	// replaces the cadence it inherits, so an interval can override a
+	// less specific cron schedule.
+	if s.Interval > 0 || s.Schedule != "" {
+		r.Interval = s.Interval
+		r.Schedule = s.Schedule
+	}
+	if s.Jitter > 0 {
+		r.Jitter = s.Jitter
+	}
+	if len(s.Blackouts) > 0 {
+		r.Blackouts = s.Blackouts
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveCadence(t *testing.T) {
+	const (
+		globalCron = "0 * * * *"
+		groupCron  = "*/15 * * * *"
+		hostCron   = "*/5 * * * *"
+	)
+	tests := []struct {
+		name         string
+		global       HostSettings
+		group        HostSettings
+		host         HostSettings
+		wantInterval time.Duration
+		wantSchedule string
+	}{
+		{
+			name:         "global interval",
+			global:       HostSettings{Interval: 5 * time.Minute},
+			wantInterval: 5 * time.Minute,
+		},
+		{
+			name:         "global schedule",
+			global:       HostSettings{Interval: 5 * time.Minute, Schedule: globalCron},
+			wantInterval: 5 * time.Minute,
+			wantSchedule: globalCron,
+		},
+		{
+			name:         "group interval over global schedule",
+			global:       HostSettings{Interval: 5 * time.Minute, Schedule: globalCron},
+			group:        HostSettings{Interval: time.Minute},
+			wantInterval: time.Minute,
+		},
+		{
+			name:         "group schedule over global interval",
+			global:       HostSettings{Interval: 5 * time.Minute},
+			group:        HostSettings{Schedule: groupCron},
+			wantSchedule: groupCron,
+		},
+		{
+			name:         "host interval over group schedule",
+			global:       HostSettings{Interval: 5 * time.Minute},
+			group:        HostSettings{Schedule: groupCron},
+			host:         HostSettings{Interval: 30 * time.Second},
+			wantInterval: 30 * time.Second,
+		},
+		{
+			name:         "host schedule over group interval",
+			global:       HostSettings{Interval: 5 * time.Minute, Schedule: globalCron},
+			group:        HostSettings{Interval: time.Minute},
+			host:         HostSettings{Schedule: hostCron},
+			wantSchedule: hostCron,
+		},
+		{
+			name:         "group sets both",
+			global:       HostSettings{Interval: 5 * time.Minute},
+			group:        HostSettings{Interval: time.Minute, Schedule: groupCron},
+			wantInterval: time.Minute,
+			wantSchedule: groupCron,
+		},
+		{
+			name:         "host without cadence inherits the group's",
+			global:       HostSettings{Interval: 5 * time.Minute, Schedule: globalCron},
+			group:        HostSettings{Interval: time.Minute},
+			host:         HostSettings{Username: "admin"},
+			wantInterval: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Interval: tt.global.Interval,
+				Schedule: tt.global.Schedule,
+				Groups:   map[string]Group{"core": {HostSettings: tt.group}},
+			}
+			host := Host{Name: "r1", Groups: []string{"core"}, HostSettings: tt.host}
+			got := host.Resolve(cfg)
+			if got.Interval != tt.wantInterval || got.Schedule != tt.wantSchedule {
+				t.Errorf("interval %s schedule %q, want %s %q", got.Interval, got.Schedule, tt.wantInterval, tt.wantSchedule)
+			}
+		})
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	insecure := true
+	cfg := &Config{
+		GNMI: GNMIConfig{
+			Username: "global",
+			Password: "global-secret",
+			Paths:    []string{"/"},
+			Type:     "config",
+			Strategy: "single",
+		},
+		Interval: 5 * time.Minute,
+		Groups: map[string]Group{
+			"core":  {HostSettings: HostSettings{Username: "core", Paths: []string{"/interfaces"}, Jitter: time.Second}},
+			"edge":  {Tags: []string{"edge"}, HostSettings: HostSettings{Username: "edge", Strategy: "per-path", Insecure: &insecure}},
+			"lab":   {Tags: []string{"lab"}, HostSettings: HostSettings{Type: "state"}},
+			"other": {Tags: []string{"other"}, HostSettings: HostSettings{Type: "all"}},
+		},
+	}
+	host := Host{
+		Name:         "r1",
+		Address:      "10.0.0.1",
+		Groups:       []string{"core", "missing"},
+		Tags:         []string{"lab", "edge"},
+		HostSettings: HostSettings{Password: "host-secret"},
+		DefaultPort:  57400,
+	}
+
+	got := host.Resolve(cfg)
+	want := HostResolved{
+		Name:     "r1",
+		Address:  "10.0.0.1:57400",
+		Target:   "r1",
+		Groups:   []string{"core", "edge", "lab"},
+		Tags:     []string{"lab", "edge"},
+		Username: "core",
+		Password: "host-secret",
+		Insecure: true,
+		Paths:    []string{"/interfaces"},
+		Type:     "state",
+		Strategy: "per-path",
+		Interval: 5 * time.Minute,
+		Jitter:   time.Second,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolved\n got %+v\nwant %+v", got, want)
+	}
+
+	// The default port is only for gNMI; other protocols have their own.
+	host.Protocol = "ssh"
+	if got := host.Resolve(cfg); got.Address != "10.0.0.1" {
+		t.Errorf("ssh address %q, want no port", got.Address)
+	}
+	host.Protocol = ""
+	host.Address = "10.0.0.1:6030"
+	if got := host.Resolve(cfg); got.Address != "10.0.0.1:6030" {
+		t.Errorf("address with port %q, want it kept", got.Address)
+	}
+}
+
+func TestAdminValidate(t *testing.T) {
+	tests := []struct {
+		admin AdminConfig
+		ok    bool
+	}{
+		{AdminConfig{}, true},
+		{AdminConfig{Listen: "127.0.0.1:8080"}, true},
+		{AdminConfig{Listen: "[::1]:8080"}, true},
+		{AdminConfig{Listen: "localhost:8080"}, true},
+		{AdminConfig{Listen: ":8080"}, false},
+		{AdminConfig{Listen: "0.0.0.0:8080"}, false},
+		{AdminConfig{Listen: "10.0.0.5:8080"}, false},
+		{AdminConfig{Listen: ":8080", Token: "secret"}, true},
+		{AdminConfig{Listen: "8080"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.admin.validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: %v, want ok %v", tt.admin, err, tt.ok)
+		}
+	}
+}
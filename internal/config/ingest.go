@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IngestEnvPrefix starts the environment variables that override the
+// config-ingest file, e.g. CONFIG_INGEST_ARANGO_PASSWORD.
+const IngestEnvPrefix = "CONFIG_INGEST_"
+
+// Kafka start offsets for a consumer group without committed offsets.
+const (
+	OffsetFirst = "first"
+	OffsetLast  = "last"
+)
+
+// IngestConfig configures config-ingest.
+type IngestConfig struct {
+	Kafka     IngestKafkaConfig     `yaml:"kafka"`
+	Arango    IngestArangoConfig    `yaml:"arango"`
+	Match     IngestMatchConfig     `yaml:"match"`
+	Retention IngestRetentionConfig `yaml:"retention"`
+}
+
+type IngestKafkaConfig struct {
+	Brokers         []string      `yaml:"brokers"`
+	Topics          []string      `yaml:"topics"`
+	Group           string        `yaml:"group"`
+	StartOffset     string        `yaml:"start_offset"`
+	CommitInterval  time.Duration `yaml:"commit_interval"`
+	DeadLetterTopic string        `yaml:"dead_letter_topic"`
+	// MaxMessageSize is the largest message the brokers accept; larger
+	// dead-lettered payloads are split into chunks.
+	MaxMessageSize int                `yaml:"max_message_size"`
+	Schemas        IngestSchemaConfig `yaml:"schemas"`
+}
+
+// IngestSchemaConfig says which schema IDs protobuf and Avro payloads may
+// carry besides 0: those listed in IDs, and those the registry at
+// RegistryURL holds the built-in schema under.
+type IngestSchemaConfig struct {
+	RegistryURL string        `yaml:"registry_url"`
+	Username    string        `yaml:"username"`
+	Password    string        `yaml:"password"`
+	Timeout     time.Duration `yaml:"timeout"`
+	IDs         []int         `yaml:"ids"`
+}
+
+// IngestArangoConfig adds how long to wait for Arango at startup and whether
+// to create missing collections and indexes.
+type IngestArangoConfig struct {
+	ArangoConfig `yaml:",inline"`
+	Wait         time.Duration `yaml:"wait"`
+	Bootstrap    bool          `yaml:"bootstrap"`
+	// HistoryCollection keeps past configs per target; empty keeps none.
+	HistoryCollection string `yaml:"history_collection"`
+}
+
+// IngestMatchConfig lists the match keys in priority order (empty for the
+// default order) and the collections to update as "collection[:kind]".
+type IngestMatchConfig struct {
+	Keys        []string `yaml:"keys"`
+	Collections []string `yaml:"collections"`
+}
+
+// IngestRetentionConfig bounds what config-ingest keeps: Chunks is how long
+// incomplete chunked messages are held in memory, History how many config
+// versions per target the history collection keeps (0 for all).
+type IngestRetentionConfig struct {
+	Chunks  time.Duration `yaml:"chunks"`
+	History int           `yaml:"history"`
+}
+
+// DefaultIngest returns the settings config-ingest runs with when neither
+// the file, the environment nor a flag sets them.
+func DefaultIngest() *IngestConfig {
+	return &IngestConfig{
+		Kafka: IngestKafkaConfig{
+			Topics:         []string{"gnmi-config"},
+			Group:          "config-ingest",
+			StartOffset:    OffsetFirst,
+			CommitInterval: time.Second,
+			MaxMessageSize: 5 * 1024 * 1024,
+		},
+		Arango: IngestArangoConfig{
+			ArangoConfig:      ArangoConfig{Timeout: 30 * time.Second},
+			Wait:              5 * time.Minute,
+			HistoryCollection: "config_history",
+		},
+		Match: IngestMatchConfig{
+			Collections: []string{"igp_node:igp", "bgp_node:bgp"},
+		},
+		Retention: IngestRetentionConfig{Chunks: 2 * time.Minute, History: 20},
+	}
+}
+
+// LoadIngest reads the config-ingest file over the defaults, then applies
+// CONFIG_INGEST_* environment variables. An empty path only applies the
+// environment. Unknown keys and malformed variables are errors; the result
+// is not validated, so flags can still fill it in.
+func LoadIngest(path string) (*IngestConfig, error) {
+	cfg := DefaultIngest()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ingestEnv maps variable names, without the prefix, to the field they set.
+var ingestEnv = map[string]func(c *IngestConfig, v string) error{
+	"KAFKA_BROKERS":           func(c *IngestConfig, v string) error { c.Kafka.Brokers = SplitList(v); return nil },
+	"KAFKA_TOPICS":            func(c *IngestConfig, v string) error { c.Kafka.Topics = SplitList(v); return nil },
+	"KAFKA_GROUP":             func(c *IngestConfig, v string) error { c.Kafka.Group = v; return nil },
+	"KAFKA_START_OFFSET":      func(c *IngestConfig, v string) error { c.Kafka.StartOffset = v; return nil },
+	"KAFKA_COMMIT_INTERVAL":   func(c *IngestConfig, v string) error { return setDuration(&c.Kafka.CommitInterval, v) },
+	"KAFKA_DEAD_LETTER_TOPIC": func(c *IngestConfig, v string) error { c.Kafka.DeadLetterTopic = v; return nil },
+	"KAFKA_MAX_MESSAGE_SIZE":  func(c *IngestConfig, v string) error { return setInt(&c.Kafka.MaxMessageSize, v) },
+	"KAFKA_SCHEMAS_REGISTRY_URL": func(c *IngestConfig, v string) error {
+		c.Kafka.Schemas.RegistryURL = v
+		return nil
+	},
+	"KAFKA_SCHEMAS_USERNAME": func(c *IngestConfig, v string) error { c.Kafka.Schemas.Username = v; return nil },
+	"KAFKA_SCHEMAS_PASSWORD": func(c *IngestConfig, v string) error { c.Kafka.Schemas.Password = v; return nil },
+	"KAFKA_SCHEMAS_TIMEOUT": func(c *IngestConfig, v string) error {
+		return setDuration(&c.Kafka.Schemas.Timeout, v)
+	},
+	"KAFKA_SCHEMAS_IDS": func(c *IngestConfig, v string) error { return setInts(&c.Kafka.Schemas.IDs, v) },
+	"ARANGO_URL":        func(c *IngestConfig, v string) error { c.Arango.URL = v; return nil },
+	"ARANGO_ENDPOINTS":  func(c *IngestConfig, v string) error { c.Arango.Endpoints = SplitList(v); return nil },
+	"ARANGO_DATABASE":   func(c *IngestConfig, v string) error { c.Arango.Database = v; return nil },
+	"ARANGO_USER":       func(c *IngestConfig, v string) error { c.Arango.User = v; return nil },
+	"ARANGO_PASSWORD":   func(c *IngestConfig, v string) error { c.Arango.Password = v; return nil },
+	"ARANGO_USER_FILE":  func(c *IngestConfig, v string) error { c.Arango.UserFile = v; return nil },
+	"ARANGO_PASS_FILE":  func(c *IngestConfig, v string) error { c.Arango.PassFile = v; return nil },
+	"ARANGO_AUTH":       func(c *IngestConfig, v string) error { c.Arango.Auth = v; return nil },
+	"ARANGO_TOKEN_FILE": func(c *IngestConfig, v string) error { c.Arango.TokenFile = v; return nil },
+	"ARANGO_CA_FILE":    func(c *IngestConfig, v string) error { c.Arango.TLS.CAFile = v; return nil },
+	"ARANGO_CERT_FILE":  func(c *IngestConfig, v string) error { c.Arango.TLS.CertFile = v; return nil },
+	"ARANGO_KEY_FILE":   func(c *IngestConfig, v string) error { c.Arango.TLS.KeyFile = v; return nil },
+	"ARANGO_INSECURE_SKIP_VERIFY": func(c *IngestConfig, v string) error {
+		return setBool(&c.Arango.TLS.InsecureSkipVerify, v)
+	},
+	"ARANGO_TIMEOUT":   func(c *IngestConfig, v string) error { return setDuration(&c.Arango.Timeout, v) },
+	"ARANGO_WAIT":      func(c *IngestConfig, v string) error { return setDuration(&c.Arango.Wait, v) },
+	"ARANGO_BOOTSTRAP": func(c *IngestConfig, v string) error { return setBool(&c.Arango.Bootstrap, v) },
+	"ARANGO_HISTORY_COLLECTION": func(c *IngestConfig, v string) error {
+		c.Arango.HistoryCollection = v
+		return nil
+	},
+	"MATCH_KEYS":        func(c *IngestConfig, v string) error { c.Match.Keys = SplitList(v); return nil },
+	"MATCH_COLLECTIONS": func(c *IngestConfig, v string) error { c.Match.Collections = SplitList(v); return nil },
+	"RETENTION_CHUNKS":  func(c *IngestConfig, v string) error { return setDuration(&c.Retention.Chunks, v) },
+	"RETENTION_HISTORY": func(c *IngestConfig, v string) error { return setInt(&c.Retention.History, v) },
+}
+
+func (c *IngestConfig) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(ingestEnv)) {
+		v, ok := lookup(IngestEnvPrefix + name)
+		if !ok {
+			continue
+		}
+		if err := ingestEnv[name](c, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", IngestEnvPrefix, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every problem with the settings at once. Without
+// withKafka, the Kafka settings are not checked, as when replaying files.
+func (c *IngestConfig) Validate(withKafka bool) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if withKafka {
+		if len(c.Kafka.Brokers) == 0 {
+			add("kafka.brokers: required")
+		}
+		if len(c.Kafka.Topics) == 0 {
+			add("kafka.topics: required")
+		}
+		if c.Kafka.Group == "" {
+			add("kafka.group: required")
+		}
+		if c.Kafka.StartOffset != OffsetFirst && c.Kafka.StartOffset != OffsetLast {
+			add("kafka.start_offset: %q is not %s or %s", c.Kafka.StartOffset, OffsetFirst, OffsetLast)
+		}
+		if c.Kafka.CommitInterval < 0 {
+			add("kafka.commit_interval: must not be negative")
+		}
+		if c.Kafka.MaxMessageSize <= 0 {
+			add("kafka.max_message_size: must be positive")
+		}
+		if c.Kafka.Schemas.Timeout < 0 {
+			add("kafka.schemas.timeout: must not be negative")
+		}
+	}
+
+	if c.Arango.URL == "" && len(c.Arango.Endpoints) == 0 {
+		add("arango.url: required")
+	}
+	if c.Arango.Database == "" {
+		add("arango.database: required")
+	}
+	switch c.Arango.Auth {
+	case "", "basic", "jwt", "none":
+	case "token":
+		if c.Arango.TokenFile == "" {
+			add("arango.token_file: required for token auth")
+		}
+	default:
+		add("arango.auth: %q is not basic, jwt, token or none", c.Arango.Auth)
+	}
+	if (c.Arango.TLS.CertFile == "") != (c.Arango.TLS.KeyFile == "") {
+		add("arango.tls: cert_file and key_file go together")
+	}
+	if c.Arango.Timeout < 0 {
+		add("arango.timeout: must not be negative")
+	}
+	if c.Arango.Wait < 0 {
+		add("arango.wait: must not be negative")
+	}
+
+	if len(c.Match.Collections) == 0 {
+		add("match.collections: required")
+	}
+	if c.Retention.Chunks <= 0 {
+		add("retention.chunks: must be positive")
+	}
+	if c.Retention.History < 0 {
+		add("retention.history: must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// SplitList splits a comma-separated list, trimming the items and dropping
+// empty ones, as list settings are given in the environment and on the
+// command line.
+func SplitList(raw string) []string {
+	out := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setInts(dst *[]int, v string) error {
+	out, err := ParseInts(v)
+	if err != nil {
+		return err
+	}
+	*dst = out
+	return nil
+}
+
+// ParseInts parses a comma-separated list of integers the way SplitList
+// splits it.
+func ParseInts(raw string) ([]int, error) {
+	out := []int{}
+	for _, part := range SplitList(raw) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
@@ -0,0 +1,102 @@
+package configdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Change ops.
+const (
+	Added   = "+"
+	Removed = "-"
+	Changed = "~"
+)
+
+// Change is one difference between two configs' leaves.
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Op {
+	case Added:
+		return fmt.Sprintf("+ %s", Entry{c.Path, c.New})
+	case Removed:
+		return fmt.Sprintf("- %s", Entry{c.Path, c.Old})
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff compares two flattened configs by path. At each path, values removed
+// and added are paired in value order into changes, and what is left over
+// is removed or added. Text leaves, which have no value, are only ever added
+// or removed.
+func Diff(a, b []Entry) []Change {
+	old := index(a)
+	cur := index(b)
+	paths := make([]string, 0, len(old)+len(cur))
+	for path := range old {
+		paths = append(paths, path)
+	}
+	for path := range cur {
+		if _, ok := old[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	// Maps leave the order open: sort by path, then changes, removals and
+	// additions by value, so one diff always prints the same.
+	sort.Strings(paths)
+
+	var out []Change
+	for _, path := range paths {
+		removed := surplus(old[path], cur[path])
+		added := surplus(cur[path], old[path])
+		var changed []Change
+		for len(removed) > 0 && len(added) > 0 && removed[0] != "" && added[0] != "" {
+			changed = append(changed, Change{Op: Changed, Path: path, Old: removed[0], New: added[0]})
+			removed, added = removed[1:], added[1:]
+		}
+		out = append(out, changed...)
+		for _, value := range removed {
+			out = append(out, Change{Op: Removed, Path: path, Old: value})
+		}
+		for _, value := range added {
+			out = append(out, Change{Op: Added, Path: path, New: value})
+		}
+	}
+	return out
+}
+
+// surplus lists, sorted with text leaves last, the values a has more often
+// than b.
+func surplus(a, b map[string]int) []string {
+	var out []string
+	for value, n := range a {
+		for i := b[value]; i < n; i++ {
+			out = append(out, value)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i] == "") != (out[j] == "") {
+			return out[j] == ""
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// index counts each path's values; text leaves may repeat.
+func index(entries []Entry) map[string]map[string]int {
+	out := make(map[string]map[string]int, len(entries))
+	for _, e := range entries {
+		if out[e.Path] == nil {
+			out[e.Path] = map[string]int{}
+		}
+		out[e.Path][e.Value]++
+	}
+	return out
+}
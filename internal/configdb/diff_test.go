@@ -0,0 +1,93 @@
+package configdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []Entry
+		want []Change
+	}{
+		{
+			name: "unchanged",
+			a:    []Entry{{"/system/hostname", "r1"}},
+			b:    []Entry{{"/system/hostname", "r1"}},
+		},
+		{
+			name: "changed value",
+			a:    []Entry{{"/system/hostname", "r1"}},
+			b:    []Entry{{"/system/hostname", "r2"}},
+			want: []Change{{Op: Changed, Path: "/system/hostname", Old: "r1", New: "r2"}},
+		},
+		{
+			name: "added and removed paths",
+			a:    []Entry{{"/a", "1"}},
+			b:    []Entry{{"/b", "2"}},
+			want: []Change{
+				{Op: Removed, Path: "/a", Old: "1"},
+				{Op: Added, Path: "/b", New: "2"},
+			},
+		},
+		{
+			// Sorted together, only the last removal sits next to an
+			// addition; every removal is still paired.
+			name: "multi-value path",
+			a: []Entry{
+				{"/dns/server", "10.0.0.1"},
+				{"/dns/server", "10.0.0.2"},
+				{"/dns/server", "10.0.0.5"},
+			},
+			b: []Entry{
+				{"/dns/server", "10.0.0.5"},
+				{"/dns/server", "10.0.0.8"},
+				{"/dns/server", "10.0.0.9"},
+			},
+			want: []Change{
+				{Op: Changed, Path: "/dns/server", Old: "10.0.0.1", New: "10.0.0.8"},
+				{Op: Changed, Path: "/dns/server", Old: "10.0.0.2", New: "10.0.0.9"},
+			},
+		},
+		{
+			name: "more removed than added",
+			a: []Entry{
+				{"/ntp/server", "a"},
+				{"/ntp/server", "b"},
+				{"/ntp/server", "c"},
+			},
+			b: []Entry{{"/ntp/server", "d"}},
+			want: []Change{
+				{Op: Changed, Path: "/ntp/server", Old: "a", New: "d"},
+				{Op: Removed, Path: "/ntp/server", Old: "b"},
+				{Op: Removed, Path: "/ntp/server", Old: "c"},
+			},
+		},
+		{
+			name: "repeated value",
+			a:    []Entry{{"/ntp/server", "a"}},
+			b:    []Entry{{"/ntp/server", "a"}, {"/ntp/server", "a"}, {"/ntp/server", "b"}},
+			want: []Change{
+				{Op: Added, Path: "/ntp/server", New: "a"},
+				{Op: Added, Path: "/ntp/server", New: "b"},
+			},
+		},
+		{
+			name: "text leaves are not paired",
+			a:    []Entry{{"cli:show running-config/interface lo", ""}, {"/x", "1"}},
+			b:    []Entry{{"cli:show running-config/interface lo", ""}, {"cli:show running-config/interface lo", ""}, {"/x", "2"}},
+			want: []Change{
+				{Op: Changed, Path: "/x", Old: "1", New: "2"},
+				{Op: Added, Path: "cli:show running-config/interface lo"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
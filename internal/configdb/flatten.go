@@ -0,0 +1,105 @@
+package configdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jalapeno/config-pub/internal/cli"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"github.com/jalapeno/config-pub/internal/ingest"
+)
+
+// textSep joins the nested lines of a text config into one path.
+const textSep = " > "
+
+// Entry is one leaf of a config. JSON leaves have the path to the value;
+// text configs have a leaf per innermost line, nested under its parents.
+type Entry struct {
+	Path  string `json:"path"`
+	Value string `json:"value,omitempty"`
+}
+
+func (e Entry) String() string {
+	if e.Value == "" {
+		return e.Path
+	}
+	return e.Path + " = " + e.Value
+}
+
+// Flatten lists a config's leaves sorted by path. List entries are named by
+// their key-like member (name, id, index, prefix) when they have one, so a
+// new entry does not shift the paths of the others.
+func Flatten(msg *gnmi.ConfigMessage) []Entry {
+	var out []Entry
+	if msg == nil {
+		return out
+	}
+	for _, u := range msg.Updates {
+		if text, ok := u.Value.(string); ok && u.Type == cli.ValueType {
+			out = flattenText(out, u.Path, ingest.ParseText(text))
+			continue
+		}
+		out = flattenValue(out, strings.TrimSuffix(u.Path, "/"), u.Value)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func flattenText(out []Entry, path string, blocks []*ingest.Block) []Entry {
+	for _, block := range blocks {
+		p := path + textSep + block.Line
+		if len(block.Children) == 0 {
+			out = append(out, Entry{Path: p})
+			continue
+		}
+		out = flattenText(out, p, block.Children)
+	}
+	return out
+}
+
+func flattenValue(out []Entry, path string, value interface{}) []Entry {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return append(out, Entry{Path: path, Value: "{}"})
+		}
+		for key, child := range v {
+			out = flattenValue(out, path+"/"+key, child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			out = flattenValue(out, path+"["+listKey(child, i)+"]", child)
+		}
+	default:
+		out = append(out, Entry{Path: path, Value: scalar(v)})
+	}
+	return out
+}
+
+var listKeys = []string{"name", "id", "index", "prefix"}
+
+func listKey(entry interface{}, i int) string {
+	if obj, ok := entry.(map[string]interface{}); ok {
+		for _, key := range listKeys {
+			for member, v := range obj {
+				if member == key || strings.HasSuffix(member, ":"+key) {
+					return key + "=" + scalar(v)
+				}
+			}
+		}
+	}
+	return fmt.Sprint(i)
+}
+
+func scalar(v interface{}) string {
+	if s, ok := v.(string); ok && s != "" {
+		return s
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
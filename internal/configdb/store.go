@@ -0,0 +1,201 @@
+// Package configdb reads the configs config-ingest stored in Arango.
+package configdb
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"github.com/jalapeno/config-pub/internal/ingest"
+)
+
+// Lookup kinds for Find.
+const (
+	ByAuto     = "auto"
+	ByName     = "name"
+	ByRouterID = "router-id"
+	ByASN      = "asn"
+)
+
+// Node is the config stored for one target, with the documents it was
+// written to.
+type Node struct {
+	Target        string              `json:"target"`
+	Address       string              `json:"address,omitempty"`
+	Documents     []string            `json:"documents"`
+	Names         []string            `json:"names,omitempty"`
+	RouterID      string              `json:"router_id,omitempty"`
+	ASN           int                 `json:"asn,omitempty"`
+	ConfigTS      time.Time           `json:"config_ts"`
+	ConfigHash    string              `json:"config_hash"`
+	RunningConfig *gnmi.ConfigMessage `json:"running_config,omitempty"`
+}
+
+// Version is one entry of a target's config history; 0 is the newest.
+type Version struct {
+	Index         int                 `json:"version"`
+	ConfigTS      time.Time           `json:"config_ts"`
+	ConfigHash    string              `json:"config_hash"`
+	RunningConfig *gnmi.ConfigMessage `json:"running_config,omitempty"`
+}
+
+type document struct {
+	ID       string `json:"_id"`
+	Name     string `json:"name"`
+	RouterID string `json:"router_id"`
+	ASN      int    `json:"asn"`
+	Source   struct {
+		Target  string `json:"target"`
+		Address string `json:"address"`
+	} `json:"config_source"`
+	ConfigTS      time.Time           `json:"config_ts"`
+	ConfigHash    string              `json:"config_hash"`
+	RunningConfig *gnmi.ConfigMessage `json:"running_config"`
+}
+
+// Store reads node configs from the collections config-ingest writes and
+// past versions from its history collection.
+type Store struct {
+	db          driver.Database
+	collections []string
+	history     string
+}
+
+func NewStore(db driver.Database, collections []string, history string) *Store {
+	return &Store{db: db, collections: collections, history: history}
+}
+
+// Find returns the nodes matching key: by name (or config target), router
+// ID or ASN. ByAuto takes a number as ASN, an address as router ID and
+// anything else as name.
+func (s *Store) Find(ctx context.Context, by, key string) ([]Node, error) {
+	if by == ByAuto {
+		by = ByName
+		if _, err := strconv.Atoi(key); err == nil {
+			by = ByASN
+		} else if _, err := netip.ParseAddr(key); err == nil {
+			by = ByRouterID
+		}
+	}
+	bindVars := map[string]interface{}{"key": key}
+	var filter string
+	switch by {
+	case ByName:
+		filter = "n.name == @key OR n.config_source.target == @key"
+	case ByRouterID:
+		filter = "n.router_id == @key"
+	case ByASN:
+		asn, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("ASN %q: %w", key, err)
+		}
+		filter = "n.asn == @key"
+		bindVars["key"] = asn
+	default:
+		return nil, fmt.Errorf("unknown lookup %q (want %s, %s, %s or %s)", by, ByAuto, ByName, ByRouterID, ByASN)
+	}
+	return s.nodes(ctx, filter, bindVars)
+}
+
+// Nodes returns every node with a stored config.
+func (s *Store) Nodes(ctx context.Context) ([]Node, error) {
+	return s.nodes(ctx, "true", map[string]interface{}{})
+}
+
+// nodes merges the documents of all collections by config target.
+func (s *Store) nodes(ctx context.Context, filter string, bindVars map[string]interface{}) ([]Node, error) {
+	byTarget := map[string]*Node{}
+	for _, collection := range s.collections {
+		vars := map[string]interface{}{"@collection": collection}
+		for k, v := range bindVars {
+			vars[k] = v
+		}
+		docs, err := query[document](ctx, s.db, `
+FOR n IN @@collection
+	FILTER n.running_config != null
+	FILTER `+filter+`
+	RETURN n
+`, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", collection, err)
+		}
+		for _, doc := range docs {
+			target := doc.Source.Target
+			if target == "" {
+				target = doc.ID
+			}
+			node, ok := byTarget[target]
+			if !ok {
+				node = &Node{Target: target, Address: doc.Source.Address}
+				byTarget[target] = node
+			}
+			node.Documents = append(node.Documents, doc.ID)
+			if doc.Name != "" && !slices.Contains(node.Names, doc.Name) {
+				node.Names = append(node.Names, doc.Name)
+			}
+			if doc.RouterID != "" {
+				node.RouterID = doc.RouterID
+			}
+			if doc.ASN != 0 {
+				node.ASN = doc.ASN
+			}
+			if node.RunningConfig == nil || doc.ConfigTS.After(node.ConfigTS) {
+				node.ConfigTS = doc.ConfigTS
+				node.ConfigHash = doc.ConfigHash
+				node.RunningConfig = doc.RunningConfig
+			}
+		}
+	}
+
+	nodes := make([]Node, 0, len(byTarget))
+	for _, node := range byTarget {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Target < nodes[j].Target })
+	return nodes, nil
+}
+
+// History returns the stored versions of a target, newest first.
+func (s *Store) History(ctx context.Context, target string) ([]Version, error) {
+	if s.history == "" {
+		return nil, fmt.Errorf("no history collection configured")
+	}
+	entries, err := query[ingest.HistoryEntry](ctx, s.db, `
+FOR h IN @@history
+	FILTER h.target == @target
+	SORT DATE_TIMESTAMP(h.config_ts) DESC
+	RETURN h
+`, map[string]interface{}{"@history": s.history, "target": target})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.history, err)
+	}
+	versions := make([]Version, len(entries))
+	for i, e := range entries {
+		versions[i] = Version{Index: i, ConfigTS: e.ConfigTS, ConfigHash: e.ConfigHash, RunningConfig: e.RunningConfig}
+	}
+	return versions, nil
+}
+
+func query[T any](ctx context.Context, db driver.Database, aql string, bindVars map[string]interface{}) ([]T, error) {
+	cursor, err := db.Query(ctx, aql, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	var out []T
+	for {
+		var v T
+		if _, err := cursor.ReadDocument(ctx, &v); driver.IsNoMoreDocuments(err) {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
@@ -0,0 +1,70 @@
+package configdb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jalapeno/config-pub/internal/cli"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+// WriteTree prints a config indented by nesting: each update's path, then
+// its JSON value as "key: value" lines or its text config as is.
+func WriteTree(w io.Writer, msg *gnmi.ConfigMessage) {
+	if msg == nil {
+		return
+	}
+	for _, u := range msg.Updates {
+		fmt.Fprintf(w, "%s:\n", u.Path)
+		if text, ok := u.Value.(string); ok && u.Type == cli.ValueType {
+			for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+				fmt.Fprintf(w, "  %s\n", line)
+			}
+			continue
+		}
+		writeValue(w, 1, u.Value)
+	}
+}
+
+func writeValue(w io.Writer, depth int, value interface{}) {
+	indent := strings.Repeat("  ", depth)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if isLeaf(v[key]) {
+				fmt.Fprintf(w, "%s%s: %s\n", indent, key, scalar(v[key]))
+				continue
+			}
+			fmt.Fprintf(w, "%s%s:\n", indent, key)
+			writeValue(w, depth+1, v[key])
+		}
+	case []interface{}:
+		for i, entry := range v {
+			if isLeaf(entry) {
+				fmt.Fprintf(w, "%s- %s\n", indent, scalar(entry))
+				continue
+			}
+			fmt.Fprintf(w, "%s[%s]\n", indent, listKey(entry, i))
+			writeValue(w, depth+1, entry)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s\n", indent, scalar(v))
+	}
+}
+
+func isLeaf(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+package coord
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+const (
+	ModeNone   = ""
+	ModeLeader = "leader"
+	ModeShard  = "shard"
+
+	BackendKubernetes = "kubernetes"
+	BackendFile       = "file"
+)
+
+// Backend stores leases. A lease belongs to a group so the holders of all
+// member leases of a deployment can be listed together.
+type Backend interface {
+	// Acquire takes or renews lease name for identity. It reports false when
+	// another identity holds an unexpired lease.
+	Acquire(ctx context.Context, name, group, identity string, ttl time.Duration) (bool, error)
+	// Release gives up lease name if identity holds it.
+	Release(ctx context.Context, name, identity string) error
+	// Holders lists the identities holding unexpired leases in group.
+	Holders(ctx context.Context, group string) ([]string, error)
+}
+
+// vnodes is the number of ring points per member; more points spread hosts
+// more evenly.
+const vnodes = 128
+
+// Coordinator decides which hosts this replica collects. In leader mode the
+// lease holder collects every host and the others stand by; in shard mode
+// every live member renews its own lease and hosts are spread over the
+// members with a consistent-hash ring, so a membership change only moves the
+// hosts of the member that joined or left. A replica that cannot renew its
+// lease before it expires owns nothing until it can.
+//
+// A nil Coordinator owns every host.
+type Coordinator struct {
+	backend  Backend
+	mode     string
+	identity string
+	lease    string
+	ttl      time.Duration
+	renew    time.Duration
+
+	stop context.CancelFunc
+	done chan struct{}
+
+	mu        sync.Mutex
+	heldUntil time.Time
+	members   []string
+	ring      []point
+	// version counts ownership changes: the ring, or the lease being
+	// gained or lost, as last seen by Version.
+	version  uint64
+	lastHeld bool
+}
+
+type point struct {
+	hash   uint64
+	member string
+}
+
+// New returns nil when coordination is disabled.
+func New(cfg config.CoordinationConfig) (*Coordinator, error) {
+	switch cfg.Mode {
+	case ModeNone:
+		return nil, nil
+	case ModeLeader, ModeShard:
+	default:
+		return nil, fmt.Errorf("unsupported coordination mode %q", cfg.Mode)
+	}
+
+	var backend Backend
+	var err error
+	switch cfg.Backend {
+	case BackendKubernetes:
+		backend, err = NewKubernetesBackend(cfg.Namespace)
+	case BackendFile:
+		backend, err = NewFileBackend(cfg.Dir)
+	default:
+		err = fmt.Errorf("unsupported coordination backend %q", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := cfg.Identity
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("coordination identity: %w", err)
+		}
+	}
+
+	return &Coordinator{
+		backend:  backend,
+		mode:     cfg.Mode,
+		identity: identity,
+		lease:    cfg.Lease,
+		ttl:      cfg.TTL,
+		renew:    cfg.Renew,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start runs the first round synchronously, so ownership is known before
+// the first collection, then keeps renewing until ctx is done or Close.
+func (c *Coordinator) Start(ctx context.Context) {
+	ctx, c.stop = context.WithCancel(ctx)
+	c.round(ctx)
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.renew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.round(ctx)
+			}
+		}
+	}()
+}
+
+// Close stops renewal and releases the lease so another replica can take
+// over at once.
+func (c *Coordinator) Close() {
+	c.stop()
+	<-c.done
+
+	c.mu.Lock()
+	c.heldUntil = time.Time{}
+	c.mu.Unlock()
+	c.release()
+}
+
+func (c *Coordinator) round(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.renew)
+	defer cancel()
+
+	name := c.lease
+	if c.mode == ModeShard {
+		name = c.lease + "-" + c.identity
+	}
+	start := time.Now()
+	held, err := c.backend.Acquire(ctx, name, c.lease, c.identity, c.ttl)
+	if err != nil {
+		log.Printf("coordination: renew lease %s: %v", name, err)
+		return
+	}
+
+	var members []string
+	if held && c.mode == ModeShard {
+		members, err = c.backend.Holders(ctx, c.lease)
+		if err != nil {
+			log.Printf("coordination: list members: %v", err)
+			return
+		}
+		if !slices.Contains(members, c.identity) {
+			members = append(members, c.identity)
+		}
+		sort.Strings(members)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wasHeld := time.Now().Before(c.heldUntil)
+	if held {
+		c.heldUntil = start.Add(c.ttl)
+	} else {
+		c.heldUntil = time.Time{}
+	}
+	if c.mode == ModeLeader && held != wasHeld {
+		if held {
+			log.Printf("coordination: %s is now the leader", c.identity)
+		} else {
+			log.Printf("coordination: %s is standing by", c.identity)
+		}
+	}
+	if c.mode == ModeShard && !slices.Equal(members, c.members) {
+		log.Printf("coordination: members %v", members)
+		c.members = members
+		c.ring = buildRing(members)
+		c.version++
+	}
+}
+
+// Version changes whenever the hosts Owns reports may have changed, so
+// callers can keep what they derive from Owns until it does. A nil
+// Coordinator's version never changes.
+func (c *Coordinator) Version() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The lease can lapse between rounds, so its state is checked here.
+	if held := time.Now().Before(c.heldUntil); held != c.lastHeld {
+		c.lastHeld = held
+		c.version++
+	}
+	return c.version
+}
+
+func (c *Coordinator) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	name := c.lease
+	if c.mode == ModeShard {
+		name = c.lease + "-" + c.identity
+	}
+	if err := c.backend.Release(ctx, name, c.identity); err != nil {
+		log.Printf("coordination: release lease %s: %v", name, err)
+	}
+}
+
+// Owns reports whether this replica should collect the host.
+func (c *Coordinator) Owns(host string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !time.Now().Before(c.heldUntil) {
+		return false
+	}
+	if c.mode == ModeLeader {
+		return true
+	}
+	return c.owner(host) == c.identity
+}
+
+// Owner returns the identity of the replica that collects the host, or ""
+// when this replica does not know it: without a lease, or in leader mode
+// when another replica leads.
+func (c *Coordinator) Owner(host string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !time.Now().Before(c.heldUntil) {
+		return ""
+	}
+	if c.mode == ModeLeader {
+		return c.identity
+	}
+	return c.owner(host)
+}
+
+func (c *Coordinator) owner(host string) string {
+	if len(c.ring) == 0 {
+		return ""
+	}
+	h := hash64(host)
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].member
+}
+
+func buildRing(members []string) []point {
+	ring := make([]point, 0, len(members)*vnodes)
+	for _, member := range members {
+		for i := 0; i < vnodes; i++ {
+			ring = append(ring, point{hash: hash64(member + "#" + strconv.Itoa(i)), member: member})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+func hash64(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
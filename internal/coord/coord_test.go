@@ -0,0 +1,150 @@
+package coord
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+func testHosts(n int) []string {
+	hosts := make([]string, n)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("xrd%03d", i)
+	}
+	return hosts
+}
+
+func owners(members []string, hosts []string) map[string]string {
+	c := &Coordinator{ring: buildRing(members)}
+	out := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		out[host] = c.owner(host)
+	}
+	return out
+}
+
+func TestRingSpread(t *testing.T) {
+	hosts := testHosts(3000)
+	members := []string{"config-pub-0", "config-pub-1", "config-pub-2"}
+	counts := map[string]int{}
+	for _, owner := range owners(members, hosts) {
+		counts[owner]++
+	}
+	for _, m := range members {
+		// An even share is 1000; vnodes keep every member well within half
+		// of it either way.
+		if counts[m] < 500 || counts[m] > 1500 {
+			t.Errorf("%s owns %d of %d hosts", m, counts[m], len(hosts))
+		}
+	}
+	if len(counts) != len(members) {
+		t.Errorf("owners %v, want only members", counts)
+	}
+}
+
+func TestRingMembershipChanges(t *testing.T) {
+	hosts := testHosts(1000)
+	before := owners([]string{"a", "b", "c"}, hosts)
+
+	// Building the ring again, or from members in another order, gives
+	// the same owners.
+	for host, owner := range owners([]string{"c", "a", "b"}, hosts) {
+		if before[host] != owner {
+			t.Fatalf("%s moved from %s to %s on a rebuilt ring", host, before[host], owner)
+		}
+	}
+
+	// A member that joins only takes hosts; nothing moves between the others.
+	joined := owners([]string{"a", "b", "c", "d"}, hosts)
+	moved := 0
+	for host, owner := range joined {
+		if owner != before[host] {
+			moved++
+			if owner != "d" {
+				t.Errorf("%s moved from %s to %s when d joined", host, before[host], owner)
+			}
+		}
+	}
+	if moved == 0 || moved > len(hosts)/2 {
+		t.Errorf("%d hosts moved when d joined", moved)
+	}
+
+	// A member that leaves only gives up its own hosts.
+	left := owners([]string{"a", "c"}, hosts)
+	for host, owner := range left {
+		if before[host] != "b" && owner != before[host] {
+			t.Errorf("%s moved from %s to %s when b left", host, before[host], owner)
+		}
+		if owner == "b" {
+			t.Errorf("%s still owned by b after it left", host)
+		}
+	}
+}
+
+func TestCoordinatorShard(t *testing.T) {
+	dir := t.TempDir()
+	start := func(identity string) *Coordinator {
+		c, err := New(config.CoordinationConfig{
+			Mode:     ModeShard,
+			Backend:  BackendFile,
+			Dir:      dir,
+			Identity: identity,
+			Lease:    "config-pub",
+			TTL:      time.Minute,
+			Renew:    50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Start(context.Background())
+		return c
+	}
+	a := start("a")
+	b := start("b")
+	// a's first round ran before b held a lease; wait for a to see b.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		n := len(a.members)
+		a.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hosts := testHosts(200)
+	for _, host := range hosts {
+		if a.Owns(host) == b.Owns(host) {
+			t.Fatalf("%s: a owns %v, b owns %v; want exactly one", host, a.Owns(host), b.Owns(host))
+		}
+		if a.Owner(host) != b.Owner(host) {
+			t.Fatalf("%s: a says %s owns it, b says %s", host, a.Owner(host), b.Owner(host))
+		}
+	}
+
+	// When b leaves, a takes over every host.
+	version := a.Version()
+	b.Close()
+	deadline = time.Now().Add(5 * time.Second)
+	for a.Version() == version && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, host := range hosts {
+		if !a.Owns(host) {
+			t.Fatalf("a does not own %s after b left", host)
+		}
+	}
+	a.Close()
+	if a.Owns(hosts[0]) || a.Owner(hosts[0]) != "" {
+		t.Error("a still owns hosts after Close")
+	}
+
+	var none *Coordinator
+	if !none.Owns(hosts[0]) || none.Owner(hosts[0]) != "" || none.Version() != 0 {
+		t.Error("a nil Coordinator must own every host")
+	}
+}
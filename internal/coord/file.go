@@ -0,0 +1,153 @@
+package coord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockStale is how old a lock file may get before it is assumed to belong
+// to a crashed process.
+const lockStale = 10 * time.Second
+
+// FileBackend keeps leases as JSON files in a shared directory, serialized
+// by an exclusive lock file. It is meant for running several replicas on one
+// machine.
+type FileBackend struct {
+	dir string
+}
+
+type fileLease struct {
+	Group  string        `json:"group"`
+	Holder string        `json:"holder"`
+	Renew  time.Time     `json:"renew"`
+	TTL    time.Duration `json:"ttl"`
+}
+
+func (l fileLease) live(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.Renew.Add(l.TTL))
+}
+
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if dir == "" {
+		return nil, errors.New("coordination dir is required for the file backend")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("coordination dir: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+func (b *FileBackend) Acquire(ctx context.Context, name, group, identity string, ttl time.Duration) (bool, error) {
+	held := false
+	err := b.locked(ctx, func() error {
+		now := time.Now()
+		current, err := b.read(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if current.live(now) && current.Holder != identity {
+			return nil
+		}
+		held = true
+		return b.write(name, fileLease{Group: group, Holder: identity, Renew: now, TTL: ttl})
+	})
+	return held, err
+}
+
+func (b *FileBackend) Release(ctx context.Context, name, identity string) error {
+	return b.locked(ctx, func() error {
+		current, err := b.read(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.Holder != identity {
+			return nil
+		}
+		return os.Remove(b.path(name))
+	})
+}
+
+func (b *FileBackend) Holders(ctx context.Context, group string) ([]string, error) {
+	var holders []string
+	err := b.locked(ctx, func() error {
+		matches, err := filepath.Glob(filepath.Join(b.dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, match := range matches {
+			current, err := b.read(strings.TrimSuffix(filepath.Base(match), ".json"))
+			if err != nil {
+				continue
+			}
+			if current.Group == group && current.live(now) {
+				holders = append(holders, current.Holder)
+			}
+		}
+		return nil
+	})
+	return holders, err
+}
+
+func (b *FileBackend) path(name string) string {
+	return filepath.Join(b.dir, name+".json")
+}
+
+func (b *FileBackend) read(name string) (fileLease, error) {
+	var l fileLease
+	raw, err := os.ReadFile(b.path(name))
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return l, fmt.Errorf("lease %s: %w", name, err)
+	}
+	return l, nil
+}
+
+// write replaces the lease file atomically.
+func (b *FileBackend) write(name string, l fileLease) error {
+	raw, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp := b.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path(name))
+}
+
+func (b *FileBackend) locked(ctx context.Context, fn func() error) error {
+	lock := filepath.Join(b.dir, ".lock")
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("lock: %w", err)
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(lock)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lock: %w", ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	defer os.Remove(lock)
+	return fn()
+}
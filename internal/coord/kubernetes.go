@@ -0,0 +1,281 @@
+package coord
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// groupLabel marks the leases of one deployment so members can be listed.
+	groupLabel = "config-pub.jalapeno.io/group"
+
+	// microTime is the wire format of metav1.MicroTime.
+	microTime = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("conflict")
+)
+
+// KubernetesBackend stores leases as coordination.k8s.io/v1 Lease objects,
+// using the pod's service account.
+type KubernetesBackend struct {
+	baseURL   string
+	namespace string
+	tokenFile string
+	client    *http.Client
+}
+
+type k8sLease struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Metadata   k8sMeta      `json:"metadata"`
+	Spec       k8sLeaseSpec `json:"spec"`
+}
+
+type k8sMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+type k8sLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+func (s k8sLeaseSpec) live(now time.Time) bool {
+	if s.HolderIdentity == "" {
+		return false
+	}
+	renewed, err := time.Parse(time.RFC3339Nano, s.RenewTime)
+	if err != nil {
+		return false
+	}
+	return now.Before(renewed.Add(time.Duration(s.LeaseDurationSeconds) * time.Second))
+}
+
+// NewKubernetesBackend uses the in-cluster API server. An empty namespace is
+// read from the service account.
+func NewKubernetesBackend(namespace string) (*KubernetesBackend, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("kubernetes backend: not running in a cluster (KUBERNETES_SERVICE_HOST unset)")
+	}
+
+	if namespace == "" {
+		raw, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes backend: namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(raw))
+	}
+
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes backend: read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("kubernetes backend: no certificates in service account CA")
+	}
+
+	return &KubernetesBackend{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		namespace: namespace,
+		tokenFile: serviceAccountDir + "/token",
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (b *KubernetesBackend) Acquire(ctx context.Context, name, group, identity string, ttl time.Duration) (bool, error) {
+	name = leaseName(name)
+	now := time.Now()
+	seconds := int((ttl + time.Second - 1) / time.Second)
+
+	var current k8sLease
+	err := b.do(ctx, http.MethodGet, b.leasePath(name), nil, &current)
+	if errors.Is(err, errNotFound) {
+		created := k8sLease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   k8sMeta{Name: name, Namespace: b.namespace, Labels: map[string]string{groupLabel: leaseName(group)}},
+			Spec: k8sLeaseSpec{
+				HolderIdentity:       identity,
+				LeaseDurationSeconds: seconds,
+				AcquireTime:          now.UTC().Format(microTime),
+				RenewTime:            now.UTC().Format(microTime),
+			},
+		}
+		err = b.do(ctx, http.MethodPost, b.leasePath(""), created, nil)
+		if errors.Is(err, errConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if current.Spec.live(now) && current.Spec.HolderIdentity != identity {
+		return false, nil
+	}
+	if current.Spec.HolderIdentity != identity {
+		current.Spec.HolderIdentity = identity
+		current.Spec.AcquireTime = now.UTC().Format(microTime)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.LeaseDurationSeconds = seconds
+	current.Spec.RenewTime = now.UTC().Format(microTime)
+
+	// The resourceVersion makes the update fail if another replica got there
+	// first.
+	err = b.do(ctx, http.MethodPut, b.leasePath(name), current, nil)
+	if errors.Is(err, errConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *KubernetesBackend) Release(ctx context.Context, name, identity string) error {
+	name = leaseName(name)
+	var current k8sLease
+	err := b.do(ctx, http.MethodGet, b.leasePath(name), nil, &current)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Spec.HolderIdentity != identity {
+		return nil
+	}
+	current.Spec.HolderIdentity = ""
+	err = b.do(ctx, http.MethodPut, b.leasePath(name), current, nil)
+	if errors.Is(err, errConflict) {
+		return nil
+	}
+	return err
+}
+
+func (b *KubernetesBackend) Holders(ctx context.Context, group string) ([]string, error) {
+	var list struct {
+		Items []k8sLease `json:"items"`
+	}
+	query := "?labelSelector=" + url.QueryEscape(groupLabel+"="+leaseName(group))
+	if err := b.do(ctx, http.MethodGet, b.leasePath("")+query, nil, &list); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var holders []string
+	for _, item := range list.Items {
+		if item.Spec.live(now) {
+			holders = append(holders, item.Spec.HolderIdentity)
+		}
+	}
+	return holders, nil
+}
+
+func (b *KubernetesBackend) leasePath(name string) string {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(b.namespace) + "/leases"
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+func (b *KubernetesBackend) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	// Projected service account tokens rotate, so read the file every time.
+	token, err := os.ReadFile(b.tokenFile)
+	if err != nil {
+		return fmt.Errorf("read service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kubernetes api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("kubernetes api: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return errConflict
+	case resp.StatusCode/100 != 2:
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &status) == nil && status.Message != "" {
+			return fmt.Errorf("kubernetes api %s %s: %s: %s", method, path, resp.Status, status.Message)
+		}
+		return fmt.Errorf("kubernetes api %s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// leaseName turns an arbitrary identity into a valid object name: lowercase
+// alphanumerics, '-' and '.', at most 253 characters.
+func leaseName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	name := strings.Trim(b.String(), "-.")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
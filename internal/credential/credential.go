@@ -0,0 +1,237 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+const (
+	defaultCache = 5 * time.Minute
+	execTimeout  = 10 * time.Second
+
+	// maxSecret bounds credential files and command output.
+	maxSecret = 64 * 1024
+)
+
+// Credentials is a username and password. It never prints the password.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+func (c Credentials) String() string {
+	return c.Username + ":<redacted>"
+}
+
+func (c Credentials) GoString() string {
+	return fmt.Sprintf("credential.Credentials{Username: %q, Password: <redacted>}", c.Username)
+}
+
+// Store resolves host credentials and caches them per host. Invalidate drops
+// a host's cached credentials so the next Get fetches them again, e.g. after
+// the device rejected them.
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]cached
+}
+
+// cached remembers what the credentials were resolved from, so a host whose
+// settings change is resolved again before the cache expires.
+type cached struct {
+	creds    Credentials
+	username string
+	password string
+	source   *config.CredentialsConfig
+	expires  time.Time
+}
+
+func NewStore() *Store {
+	return &Store{entries: map[string]cached{}}
+}
+
+func (s *Store) Get(ctx context.Context, host config.HostResolved) (Credentials, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[host.Name]
+	s.mu.Unlock()
+	if ok && entry.username == host.Username && entry.password == host.Password &&
+		entry.source == host.Credentials && time.Now().Before(entry.expires) {
+		return entry.creds, nil
+	}
+
+	creds, err := Resolve(ctx, host)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credentials for %s: %w", host.Name, err)
+	}
+
+	ttl := defaultCache
+	if host.Credentials != nil && host.Credentials.Cache > 0 {
+		ttl = host.Credentials.Cache
+	}
+	s.mu.Lock()
+	s.entries[host.Name] = cached{
+		creds:    creds,
+		username: host.Username,
+		password: host.Password,
+		source:   host.Credentials,
+		expires:  time.Now().Add(ttl),
+	}
+	s.mu.Unlock()
+	return creds, nil
+}
+
+func (s *Store) Invalidate(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, name)
+}
+
+// WithRetry runs fn with the host's credentials. When fn fails with an error
+// isAuthErr accepts, the device rejected them: they are fetched again, and
+// fn retried once if they changed. Otherwise fn's error is returned.
+func (s *Store) WithRetry(ctx context.Context, host config.HostResolved, isAuthErr func(error) bool, fn func(Credentials) error) error {
+	creds, err := s.Get(ctx, host)
+	if err != nil {
+		return err
+	}
+	err = fn(creds)
+	if err == nil || !isAuthErr(err) {
+		return err
+	}
+
+	s.Invalidate(host.Name)
+	fresh, freshErr := s.Get(ctx, host)
+	if freshErr != nil {
+		log.Printf("refresh credentials for %s after authentication failure: %v", host.Name, freshErr)
+		return err
+	}
+	if fresh == creds {
+		return err
+	}
+	log.Printf("credentials for %s changed after authentication failure; retrying", host.Name)
+	return fn(fresh)
+}
+
+// Resolve fetches credentials without caching: the plain username and
+// password with ${VAR} expanded, overridden by the files and then the
+// command of host.Credentials.
+func Resolve(ctx context.Context, host config.HostResolved) (Credentials, error) {
+	var creds Credentials
+	var err error
+	if creds.Username, err = Expand(host.Username); err != nil {
+		return Credentials{}, fmt.Errorf("username: %w", err)
+	}
+	if creds.Password, err = Expand(host.Password); err != nil {
+		return Credentials{}, fmt.Errorf("password: %w", err)
+	}
+
+	src := host.Credentials
+	if src == nil {
+		return creds, nil
+	}
+	if src.UserFile != "" {
+		if creds.Username, err = readSecret(src.UserFile); err != nil {
+			return Credentials{}, fmt.Errorf("read username: %w", err)
+		}
+	}
+	if src.PassFile != "" {
+		if creds.Password, err = readSecret(src.PassFile); err != nil {
+			return Credentials{}, fmt.Errorf("read password: %w", err)
+		}
+	}
+	if len(src.Exec) > 0 {
+		out, err := runExec(ctx, src.Exec, host)
+		if err != nil {
+			return Credentials{}, err
+		}
+		if out.Username != "" {
+			creds.Username = out.Username
+		}
+		if out.Password != "" {
+			creds.Password = out.Password
+		}
+	}
+	return creds, nil
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Expand replaces ${VAR} with the value of the environment variable VAR. An
+// unset variable is an error; the message names the variable, never a value.
+func Expand(s string) (string, error) {
+	var missing []string
+	out := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func readSecret(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(io.LimitReader(f, maxSecret+1))
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > maxSecret {
+		return "", errors.New("credential too long")
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
+// runExec runs the credential command with the host's name and address in
+// CONFIG_PUB_HOST and CONFIG_PUB_ADDRESS. Its output is never included in
+// errors since it may hold the secret.
+func runExec(ctx context.Context, command []string, host config.HostResolved) (Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "CONFIG_PUB_HOST="+host.Name, "CONFIG_PUB_ADDRESS="+host.Address)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return Credentials{}, fmt.Errorf("credential command %s: %w", command[0], err)
+	}
+	if stdout.Len() > maxSecret {
+		return Credentials{}, fmt.Errorf("credential command %s: output too long", command[0])
+	}
+
+	out := bytes.TrimSpace(stdout.Bytes())
+	if bytes.HasPrefix(out, []byte("{")) {
+		var parsed struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal(out, &parsed); err != nil {
+			return Credentials{}, fmt.Errorf("credential command %s: output is not valid JSON", command[0])
+		}
+		return Credentials{Username: parsed.Username, Password: parsed.Password}, nil
+	}
+
+	user, pass, _ := strings.Cut(string(out), "\n")
+	return Credentials{Username: strings.TrimRight(user, "\r"), Password: strings.TrimRight(pass, "\r\n")}, nil
+}
@@ -0,0 +1,142 @@
+package format
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+// marshalAvro writes the binary encoding of config_message.avsc. Values are
+// carried as JSON strings since Avro has no schemaless type.
+func marshalAvro(msg *gnmi.ConfigMessage) ([]byte, error) {
+	var b []byte
+	b = appendAvroLong(b, msg.Timestamp.UnixMicro())
+	b = appendAvroString(b, msg.Target)
+	b = appendAvroString(b, msg.Address)
+	b = appendAvroString(b, msg.Encoding)
+	b = appendAvroString(b, msg.Type)
+
+	if len(msg.Updates) > 0 {
+		b = appendAvroLong(b, int64(len(msg.Updates)))
+		for _, update := range msg.Updates {
+			value, err := json.Marshal(update.Value)
+			if err != nil {
+				return nil, fmt.Errorf("update %s: %w", update.Path, err)
+			}
+			b = appendAvroString(b, update.Path)
+			b = appendAvroString(b, string(value))
+			b = appendAvroString(b, update.Type)
+		}
+	}
+	b = appendAvroLong(b, 0)
+
+	if len(msg.Errors) > 0 {
+		b = appendAvroLong(b, int64(len(msg.Errors)))
+		for _, collectErr := range msg.Errors {
+			b = appendAvroString(b, collectErr.Path)
+			b = appendAvroString(b, collectErr.Error)
+		}
+	}
+	b = appendAvroLong(b, 0)
+	return b, nil
+}
+
+func unmarshalAvro(b []byte, msg *gnmi.ConfigMessage) error {
+	r := &avroReader{buf: b}
+
+	msg.Timestamp = time.UnixMicro(r.long()).UTC()
+	msg.Target = r.string()
+	msg.Address = r.string()
+	msg.Encoding = r.string()
+	msg.Type = r.string()
+
+	r.array(func() {
+		update := gnmi.ConfigUpdate{Path: r.string()}
+		raw := r.string()
+		update.Type = r.string()
+		if r.err != nil {
+			return
+		}
+		if err := json.Unmarshal([]byte(raw), &update.Value); err != nil {
+			r.err = fmt.Errorf("update %s: %w", update.Path, err)
+			return
+		}
+		msg.Updates = append(msg.Updates, update)
+	})
+
+	r.array(func() {
+		collectErr := gnmi.CollectError{Path: r.string(), Error: r.string()}
+		if r.err == nil {
+			msg.Errors = append(msg.Errors, collectErr)
+		}
+	})
+
+	if r.err != nil {
+		return fmt.Errorf("avro: %w", r.err)
+	}
+	return nil
+}
+
+func appendAvroLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = appendAvroLong(b, int64(len(s)))
+	return append(b, s...)
+}
+
+// avroReader decodes Avro primitives; the first error sticks and turns every
+// later read into a no-op.
+type avroReader struct {
+	buf []byte
+	err error
+}
+
+func (r *avroReader) long() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid long")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *avroReader) string() string {
+	size := r.long()
+	if r.err != nil {
+		return ""
+	}
+	if size < 0 || int64(len(r.buf)) < size {
+		r.err = fmt.Errorf("invalid string length %d", size)
+		return ""
+	}
+	s := string(r.buf[:size])
+	r.buf = r.buf[size:]
+	return s
+}
+
+// array reads blocks until the zero-count terminator. A negative count is
+// followed by the block's byte size, which is not needed here.
+func (r *avroReader) array(item func()) {
+	for r.err == nil {
+		count := r.long()
+		if count == 0 || r.err != nil {
+			return
+		}
+		if count < 0 {
+			count = -count
+			r.long()
+		}
+		for i := int64(0); i < count && r.err == nil; i++ {
+			item()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+// Decoder unmarshals payloads like Unmarshal, but only accepts framed
+// payloads whose schema ID says they were written with the built-in schema:
+// 0 (no registry at the producer), the IDs it was given, or an ID the
+// registry resolves to the built-in schema of the payload's type.
+type Decoder struct {
+	registry Registry
+
+	mu sync.Mutex
+	// checked holds the verdict per schema ID and type; registry errors are
+	// not kept, so the lookup is retried.
+	checked map[string]error
+	known   map[int]bool
+}
+
+// NewDecoder returns a Decoder accepting the given schema IDs and, with a
+// registry, any ID registered with the built-in schema.
+func NewDecoder(registry Registry, ids []int) *Decoder {
+	known := map[int]bool{0: true}
+	for _, id := range ids {
+		known[id] = true
+	}
+	return &Decoder{registry: registry, checked: map[string]error{}, known: known}
+}
+
+func (d *Decoder) Unmarshal(ctx context.Context, contentType string, payload []byte, msg *gnmi.ConfigMessage) error {
+	return unmarshal(contentType, payload, msg, func(id int, schemaType string) error {
+		return d.check(ctx, id, schemaType)
+	})
+}
+
+func (d *Decoder) check(ctx context.Context, id int, schemaType string) error {
+	if d.known[id] {
+		return nil
+	}
+	key := fmt.Sprintf("%s/%d", schemaType, id)
+	d.mu.Lock()
+	verdict, ok := d.checked[key]
+	d.mu.Unlock()
+	if ok {
+		return verdict
+	}
+	if d.registry == nil {
+		return fmt.Errorf("unknown schema ID %d (no schema registry configured)", id)
+	}
+
+	schema, err := d.registry.Lookup(ctx, id)
+	if err != nil {
+		return fmt.Errorf("look up schema ID %d: %w", id, err)
+	}
+	builtin := Schema{Type: schemaType, Definition: ProtoSchema}
+	if schemaType == SchemaTypeAvro {
+		builtin.Definition = AvroSchema
+	}
+	if !sameSchema(schema, builtin) {
+		verdict = fmt.Errorf("schema ID %d is not the built-in %s schema", id, strings.ToLower(schemaType))
+	}
+	d.mu.Lock()
+	d.checked[key] = verdict
+	d.mu.Unlock()
+	return verdict
+}
+
+var protoComment = regexp.MustCompile(`//[^\n]*`)
+
+// sameSchema compares two schemas of one type, ignoring formatting: Avro
+// schemas as compact JSON, protobuf schemas without comments and with
+// whitespace collapsed.
+func sameSchema(a, b Schema) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Type == SchemaTypeAvro {
+		var ca, cb bytes.Buffer
+		if json.Compact(&ca, []byte(a.Definition)) == nil && json.Compact(&cb, []byte(b.Definition)) == nil {
+			return ca.String() == cb.String()
+		}
+	}
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(protoComment.ReplaceAllString(s, "")), " ")
+	}
+	return normalize(a.Definition) == normalize(b.Definition)
+}
@@ -0,0 +1,184 @@
+package format
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	JSON     = "json"
+	Protobuf = "protobuf"
+	Avro     = "avro"
+
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "avro/binary"
+
+	// magicByte starts every Confluent wire-format message, followed by the
+	// 4-byte big-endian schema ID.
+	magicByte = 0
+)
+
+var (
+	//go:embed config_message.proto
+	ProtoSchema string
+
+	//go:embed config_message.avsc
+	AvroSchema string
+)
+
+// Codec serializes ConfigMessages in one format. Protobuf and Avro payloads
+// use Confluent wire-format framing; the schema ID is 0 when no registry is
+// configured.
+type Codec struct {
+	format   string
+	schemaID int
+}
+
+// NewCodec registers the format's schema under subject when a registry is
+// given. JSON payloads are never framed and need no registry.
+func NewCodec(ctx context.Context, format string, registry Registry, subject string) (*Codec, error) {
+	codec := &Codec{format: format}
+	switch format {
+	case "", JSON:
+		codec.format = JSON
+		return codec, nil
+	case Protobuf, Avro:
+	default:
+		return nil, fmt.Errorf("unsupported message format %q", format)
+	}
+
+	if registry != nil {
+		id, err := registry.Register(ctx, subject, codec.schema())
+		if err != nil {
+			return nil, fmt.Errorf("register schema for %s: %w", subject, err)
+		}
+		codec.schemaID = id
+	}
+	return codec, nil
+}
+
+func (c *Codec) schema() Schema {
+	if c.format == Avro {
+		return Schema{Type: SchemaTypeAvro, Definition: AvroSchema}
+	}
+	return Schema{Type: SchemaTypeProtobuf, Definition: ProtoSchema}
+}
+
+func (c *Codec) ContentType() string {
+	switch c.format {
+	case Protobuf:
+		return ContentTypeProtobuf
+	case Avro:
+		return ContentTypeAvro
+	default:
+		return ContentTypeJSON
+	}
+}
+
+func (c *Codec) SchemaID() int {
+	return c.schemaID
+}
+
+func (c *Codec) Marshal(msg *gnmi.ConfigMessage) ([]byte, error) {
+	switch c.format {
+	case Protobuf:
+		body, err := marshalProto(msg)
+		if err != nil {
+			return nil, err
+		}
+		// A single-element message index of [0] (the first message in the
+		// schema) is written as one zero byte.
+		return append(frame(c.schemaID, []byte{0}), body...), nil
+	case Avro:
+		body, err := marshalAvro(msg)
+		if err != nil {
+			return nil, err
+		}
+		return append(frame(c.schemaID, nil), body...), nil
+	default:
+		return json.Marshal(msg)
+	}
+}
+
+// Unmarshal decodes a payload of the given content type. An empty content
+// type is treated as JSON. The schema ID of framed payloads is not checked;
+// see Decoder.
+func Unmarshal(contentType string, payload []byte, msg *gnmi.ConfigMessage) error {
+	return unmarshal(contentType, payload, msg, nil)
+}
+
+// unmarshal decodes payload after passing the schema ID of framed payloads
+// to check, when it is not nil.
+func unmarshal(contentType string, payload []byte, msg *gnmi.ConfigMessage, check func(id int, schemaType string) error) error {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return json.Unmarshal(payload, msg)
+	case ContentTypeProtobuf:
+		body, id, err := unframe(payload)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(id, SchemaTypeProtobuf); err != nil {
+				return err
+			}
+		}
+		body, err = skipMessageIndexes(body)
+		if err != nil {
+			return err
+		}
+		return unmarshalProto(body, msg)
+	case ContentTypeAvro:
+		body, id, err := unframe(payload)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(id, SchemaTypeAvro); err != nil {
+				return err
+			}
+		}
+		return unmarshalAvro(body, msg)
+	default:
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+func frame(schemaID int, indexes []byte) []byte {
+	out := make([]byte, 5, 5+len(indexes))
+	out[0] = magicByte
+	binary.BigEndian.PutUint32(out[1:], uint32(schemaID))
+	return append(out, indexes...)
+}
+
+func unframe(payload []byte) ([]byte, int, error) {
+	if len(payload) < 5 || payload[0] != magicByte {
+		return nil, 0, fmt.Errorf("missing wire-format header")
+	}
+	return payload[5:], int(binary.BigEndian.Uint32(payload[1:5])), nil
+}
+
+// skipMessageIndexes drops the protobuf message-index array: a zigzag varint
+// count followed by that many zigzag varint indexes, or a lone 0 for [0].
+func skipMessageIndexes(body []byte) ([]byte, error) {
+	count, n := protowire.ConsumeVarint(body)
+	if n < 0 {
+		return nil, fmt.Errorf("message indexes: %w", protowire.ParseError(n))
+	}
+	body = body[n:]
+	for i := int64(0); i < protowire.DecodeZigZag(count); i++ {
+		_, n := protowire.ConsumeVarint(body)
+		if n < 0 {
+			return nil, fmt.Errorf("message indexes: %w", protowire.ParseError(n))
+		}
+		body = body[n:]
+	}
+	return body, nil
+}
@@ -0,0 +1,187 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jalapeno/config-pub/internal/gnmi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Field numbers from config_message.proto.
+const (
+	fieldMessageTimestamp = 1
+	fieldMessageTarget    = 2
+	fieldMessageAddress   = 3
+	fieldMessageEncoding  = 4
+	fieldMessageType      = 5
+	fieldMessageUpdates   = 6
+	fieldMessageErrors    = 7
+
+	fieldUpdatePath      = 1
+	fieldUpdateValue     = 2
+	fieldUpdateValueType = 3
+
+	fieldErrorPath  = 1
+	fieldErrorError = 2
+)
+
+func marshalProto(msg *gnmi.ConfigMessage) ([]byte, error) {
+	ts, err := proto.Marshal(timestamppb.New(msg.Timestamp))
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendBytesField(b, fieldMessageTimestamp, ts)
+	b = appendStringField(b, fieldMessageTarget, msg.Target)
+	b = appendStringField(b, fieldMessageAddress, msg.Address)
+	b = appendStringField(b, fieldMessageEncoding, msg.Encoding)
+	b = appendStringField(b, fieldMessageType, msg.Type)
+
+	for _, update := range msg.Updates {
+		value, err := valueToProto(update.Value)
+		if err != nil {
+			return nil, fmt.Errorf("update %s: %w", update.Path, err)
+		}
+		var u []byte
+		u = appendStringField(u, fieldUpdatePath, update.Path)
+		u = appendBytesField(u, fieldUpdateValue, value)
+		u = appendStringField(u, fieldUpdateValueType, update.Type)
+		b = appendBytesField(b, fieldMessageUpdates, u)
+	}
+
+	for _, collectErr := range msg.Errors {
+		var e []byte
+		e = appendStringField(e, fieldErrorPath, collectErr.Path)
+		e = appendStringField(e, fieldErrorError, collectErr.Error)
+		b = appendBytesField(b, fieldMessageErrors, e)
+	}
+	return b, nil
+}
+
+func unmarshalProto(b []byte, msg *gnmi.ConfigMessage) error {
+	return consumeFields(b, func(num protowire.Number, raw []byte) error {
+		switch num {
+		case fieldMessageTimestamp:
+			var ts timestamppb.Timestamp
+			if err := proto.Unmarshal(raw, &ts); err != nil {
+				return fmt.Errorf("timestamp: %w", err)
+			}
+			msg.Timestamp = ts.AsTime()
+		case fieldMessageTarget:
+			msg.Target = string(raw)
+		case fieldMessageAddress:
+			msg.Address = string(raw)
+		case fieldMessageEncoding:
+			msg.Encoding = string(raw)
+		case fieldMessageType:
+			msg.Type = string(raw)
+		case fieldMessageUpdates:
+			var update gnmi.ConfigUpdate
+			err := consumeFields(raw, func(num protowire.Number, raw []byte) error {
+				switch num {
+				case fieldUpdatePath:
+					update.Path = string(raw)
+				case fieldUpdateValue:
+					value, err := valueFromProto(raw)
+					if err != nil {
+						return err
+					}
+					update.Value = value
+				case fieldUpdateValueType:
+					update.Type = string(raw)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("update: %w", err)
+			}
+			msg.Updates = append(msg.Updates, update)
+		case fieldMessageErrors:
+			var collectErr gnmi.CollectError
+			err := consumeFields(raw, func(num protowire.Number, raw []byte) error {
+				switch num {
+				case fieldErrorPath:
+					collectErr.Path = string(raw)
+				case fieldErrorError:
+					collectErr.Error = string(raw)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+			msg.Errors = append(msg.Errors, collectErr)
+		}
+		return nil
+	})
+}
+
+// consumeFields walks a message and hands every length-delimited field to fn.
+// Other wire types are skipped; this schema has none.
+func consumeFields(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		raw, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendStringField(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// valueToProto converts a decoded gNMI value into a google.protobuf.Value by
+// way of its JSON form, which is how the JSON format publishes it too.
+func valueToProto(value interface{}) ([]byte, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var pv structpb.Value
+	if err := protojson.Unmarshal(raw, &pv); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&pv)
+}
+
+func valueFromProto(raw []byte) (interface{}, error) {
+	var pv structpb.Value
+	if err := proto.Unmarshal(raw, &pv); err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+	return pv.AsInterface(), nil
+}
@@ -0,0 +1,171 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeAvro     = "AVRO"
+)
+
+type Schema struct {
+	Type       string
+	Definition string
+}
+
+// Registry resolves schemas to IDs for wire-format framing.
+type Registry interface {
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+	Lookup(ctx context.Context, id int) (Schema, error)
+}
+
+type RegistryConfig struct {
+	URL      string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// HTTPRegistry talks to a Confluent-compatible schema registry REST API.
+type HTTPRegistry struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mu    sync.Mutex
+	byID  map[int]Schema
+	bySub map[string]int
+}
+
+func NewHTTPRegistry(cfg RegistryConfig) (*HTTPRegistry, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("schema registry url is required")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("schema registry url: %w", err)
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPRegistry{
+		baseURL:  strings.TrimRight(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   &http.Client{Timeout: timeout},
+		byID:     map[int]Schema{},
+		bySub:    map[string]int{},
+	}, nil
+}
+
+type registrySchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+func (r *HTTPRegistry) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	cacheKey := subject + "\x00" + schema.Definition
+	r.mu.Lock()
+	if id, ok := r.bySub[cacheKey]; ok {
+		r.mu.Unlock()
+		return id, nil
+	}
+	r.mu.Unlock()
+
+	body := registrySchema{Schema: schema.Definition}
+	// The registry defaults to Avro and older versions reject an explicit type.
+	if schema.Type != SchemaTypeAvro {
+		body.SchemaType = schema.Type
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &resp); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	r.bySub[cacheKey] = resp.ID
+	r.byID[resp.ID] = schema
+	r.mu.Unlock()
+	return resp.ID, nil
+}
+
+func (r *HTTPRegistry) Lookup(ctx context.Context, id int) (Schema, error) {
+	r.mu.Lock()
+	if schema, ok := r.byID[id]; ok {
+		r.mu.Unlock()
+		return schema, nil
+	}
+	r.mu.Unlock()
+
+	var resp registrySchema
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return Schema{}, err
+	}
+	schema := Schema{Type: resp.SchemaType, Definition: resp.Schema}
+	if schema.Type == "" {
+		schema.Type = SchemaTypeAvro
+	}
+
+	r.mu.Lock()
+	r.byID[id] = schema
+	r.mu.Unlock()
+	return schema, nil
+}
+
+func (r *HTTPRegistry) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("schema registry %s %s: %d %s", method, path, apiErr.ErrorCode, apiErr.Message)
+		}
+		return fmt.Errorf("schema registry %s %s: %s", method, path, resp.Status)
+	}
+	return json.Unmarshal(raw, out)
+}
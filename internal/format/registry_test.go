@@ -0,0 +1,241 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+// fakeRegistry is a minimal stand-in for the Confluent schema registry REST
+// API, counting the requests it serves.
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []registrySchema
+	requests int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+		var body registrySchema
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, s := range f.schemas {
+			if s == body {
+				fmt.Fprintf(w, `{"id":%d}`, i+1)
+				return
+			}
+		}
+		f.schemas = append(f.schemas, body)
+		fmt.Fprintf(w, `{"id":%d}`, len(f.schemas))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		var id int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"), "%d", &id)
+		if id < 1 || id > len(f.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40403,"message":"Schema not found"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(f.schemas[id-1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRegistry) add(schema registrySchema) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemas = append(f.schemas, schema)
+	return len(f.schemas)
+}
+
+func (f *fakeRegistry) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func newTestRegistry(t *testing.T) (*fakeRegistry, *HTTPRegistry) {
+	t.Helper()
+	fake := &fakeRegistry{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	registry, err := NewHTTPRegistry(RegistryConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, registry
+}
+
+func TestHTTPRegistryCaches(t *testing.T) {
+	ctx := context.Background()
+	fake, registry := newTestRegistry(t)
+
+	avro := Schema{Type: SchemaTypeAvro, Definition: AvroSchema}
+	id, err := registry.Register(ctx, "gnmi-config-value", avro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := registry.Register(ctx, "gnmi-config-value", avro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id || fake.count() != 1 {
+		t.Fatalf("second register: id %d (want %d), %d requests (want 1)", again, id, fake.count())
+	}
+	if got := fake.schemas[0].SchemaType; got != "" {
+		t.Errorf("avro registered with schemaType %q, want none", got)
+	}
+
+	// Registering fills the lookup cache.
+	schema, err := registry.Lookup(ctx, id)
+	if err != nil || schema != avro || fake.count() != 1 {
+		t.Fatalf("lookup of registered id: %+v, %v, %d requests", schema, err, fake.count())
+	}
+
+	protoID := fake.add(registrySchema{Schema: ProtoSchema, SchemaType: SchemaTypeProtobuf})
+	for i := 0; i < 2; i++ {
+		schema, err := registry.Lookup(ctx, protoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.Type != SchemaTypeProtobuf || schema.Definition != ProtoSchema {
+			t.Fatalf("lookup %d: got %+v", protoID, schema)
+		}
+	}
+	if fake.count() != 2 {
+		t.Errorf("two lookups of one id made %d requests, want 1", fake.count()-1)
+	}
+
+	if _, err := registry.Lookup(ctx, 99); err == nil || !strings.Contains(err.Error(), "Schema not found") {
+		t.Errorf("lookup of unknown id: %v", err)
+	}
+}
+
+func testMessage() *gnmi.ConfigMessage {
+	return &gnmi.ConfigMessage{
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Target:    "xrd01",
+		Address:   "10.0.0.1:57400",
+		Encoding:  "json_ietf",
+		Type:      "config",
+		Updates: []gnmi.ConfigUpdate{{
+			Path:  "/",
+			Value: map[string]interface{}{"hostname": "xrd01", "mtu": float64(9000)},
+		}},
+		Errors: []gnmi.CollectError{{Path: "/bad", Error: "not supported"}},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, f := range []string{Protobuf, Avro} {
+		t.Run(f, func(t *testing.T) {
+			_, registry := newTestRegistry(t)
+			codec, err := NewCodec(ctx, f, registry, "gnmi-config-value")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.SchemaID() == 0 {
+				t.Fatal("no schema ID from the registry")
+			}
+			want := testMessage()
+			payload, err := codec.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A fresh registry client has to look the ID up.
+			lookup, err := NewHTTPRegistry(RegistryConfig{URL: registry.baseURL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got gnmi.ConfigMessage
+			if err := NewDecoder(lookup, nil).Unmarshal(ctx, codec.ContentType(), payload, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&got, want) {
+				t.Errorf("round trip:\n got %+v\nwant %+v", &got, want)
+			}
+		})
+	}
+}
+
+func TestDecoderSchemaIDs(t *testing.T) {
+	ctx := context.Background()
+	fake, registry := newTestRegistry(t)
+	other := fake.add(registrySchema{Schema: `{"type":"record","name":"Other","fields":[]}`})
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(AvroSchema)); err != nil {
+		t.Fatal(err)
+	}
+	reformatted := fake.add(registrySchema{Schema: compact.String()})
+
+	plain, err := NewCodec(ctx, Avro, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := plain.Marshal(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	withID := func(id int) []byte {
+		return append(frame(id, nil), payload[5:]...)
+	}
+
+	tests := []struct {
+		name    string
+		decoder *Decoder
+		id      int
+		wantErr string
+	}{
+		{"no registry, ID 0", NewDecoder(nil, nil), 0, ""},
+		{"no registry, listed ID", NewDecoder(nil, []int{other}), other, ""},
+		{"no registry, unknown ID", NewDecoder(nil, nil), 7, "unknown schema ID 7"},
+		{"other schema", NewDecoder(registry, nil), other, "not the built-in avro schema"},
+		{"same schema, other formatting", NewDecoder(registry, nil), reformatted, ""},
+		{"ID not registered", NewDecoder(registry, nil), 42, "look up schema ID 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg gnmi.ConfigMessage
+			err := tt.decoder.Unmarshal(ctx, ContentTypeAvro, withID(tt.id), &msg)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A schema ID rejected once is not looked up again.
+	fresh, err := NewHTTPRegistry(RegistryConfig{URL: registry.baseURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := NewDecoder(fresh, nil)
+	var msg gnmi.ConfigMessage
+	before := fake.count()
+	for i := 0; i < 3; i++ {
+		decoder.Unmarshal(ctx, ContentTypeAvro, withID(other), &msg)
+	}
+	if n := fake.count() - before; n != 1 {
+		t.Errorf("three payloads with a foreign schema ID made %d lookups, want 1", n)
+	}
+}
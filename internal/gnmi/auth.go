@@ -1,6 +1,77 @@
 package gnmi
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/credential"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	AuthBasic  = "basic"
+	AuthToken  = "token"
+	AuthOAuth2 = "oauth2"
+	AuthMTLS   = "mtls"
+	AuthNone   = "none"
+
+	// tokenRefreshMargin renews OAuth2 tokens this long before they expire.
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// perRPCCredentials returns the metadata credentials for the host's auth
+// mode, or nil when none are sent.
+func perRPCCredentials(host config.HostResolved) (credentials.PerRPCCredentials, error) {
+	var auth config.AuthConfig
+	if host.Auth != nil {
+		auth = *host.Auth
+	}
+	requireTLS := !host.Insecure
+
+	switch auth.Mode {
+	case "", AuthBasic:
+		if host.Username == "" && host.Password == "" {
+			return nil, nil
+		}
+		return newBasicAuth(host.Username, host.Password, requireTLS), nil
+	case AuthToken:
+		if auth.TokenFile != "" {
+			return &tokenAuth{file: auth.TokenFile, requireTLS: requireTLS}, nil
+		}
+		token, err := credential.Expand(auth.Token)
+		if err != nil {
+			return nil, fmt.Errorf("auth token: %w", err)
+		}
+		if token == "" {
+			return nil, errors.New("auth mode token needs token or token_file")
+		}
+		return &tokenAuth{token: token, requireTLS: requireTLS}, nil
+	case AuthOAuth2:
+		return newOAuth2Auth(auth.OAuth2, requireTLS)
+	case AuthMTLS:
+		if host.Insecure {
+			return nil, errors.New("auth mode mtls needs TLS; unset insecure")
+		}
+		if host.TLS.CertFile == "" || host.TLS.KeyFile == "" {
+			return nil, errors.New("auth mode mtls needs tls cert_file and key_file")
+		}
+		return nil, nil
+	case AuthNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth mode %q", auth.Mode)
+	}
+}
 
 type basicAuth struct {
 	username   string
@@ -26,3 +97,164 @@ func (b *basicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[
 func (b *basicAuth) RequireTransportSecurity() bool {
 	return b.requireTLS
 }
+
+// tokenAuth sends a bearer token. A token file is re-read whenever its
+// modification time or size changes, so rotated tokens apply to the next RPC.
+type tokenAuth struct {
+	token      string
+	file       string
+	requireTLS bool
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+func (t *tokenAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+func (t *tokenAuth) current() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == "" {
+		return t.token, nil
+	}
+
+	info, err := os.Stat(t.file)
+	if err != nil {
+		return "", fmt.Errorf("token file: %w", err)
+	}
+	if t.token != "" && info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return t.token, nil
+	}
+	raw, err := os.ReadFile(t.file)
+	if err != nil {
+		return "", fmt.Errorf("token file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", t.file)
+	}
+	t.token, t.modTime, t.size = token, info.ModTime(), info.Size()
+	return t.token, nil
+}
+
+func (t *tokenAuth) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+// oauth2Auth fetches access tokens with the client-credentials grant and
+// reuses each one until shortly before it expires.
+type oauth2Auth struct {
+	cfg        config.OAuth2Config
+	secret     string
+	client     *http.Client
+	requireTLS bool
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newOAuth2Auth(cfg config.OAuth2Config, requireTLS bool) (*oauth2Auth, error) {
+	if cfg.TokenURL == "" || cfg.ClientID == "" {
+		return nil, errors.New("auth mode oauth2 needs token_url and client_id")
+	}
+	if _, err := url.Parse(cfg.TokenURL); err != nil {
+		return nil, fmt.Errorf("oauth2 token_url: %w", err)
+	}
+	secret, err := credential.Expand(cfg.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 client_secret: %w", err)
+	}
+	return &oauth2Auth{
+		cfg:        cfg,
+		secret:     secret,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		requireTLS: requireTLS,
+	}, nil
+}
+
+func (o *oauth2Auth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token == "" || time.Now().After(o.expires) {
+		if err := o.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]string{"authorization": "Bearer " + o.token}, nil
+}
+
+func (o *oauth2Auth) fetch(ctx context.Context) error {
+	secret := o.secret
+	if o.cfg.ClientSecretFile != "" {
+		raw, err := os.ReadFile(o.cfg.ClientSecretFile)
+		if err != nil {
+			return fmt.Errorf("oauth2 client secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(raw))
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.cfg.Scopes, " "))
+	}
+	for k, v := range o.cfg.Params {
+		form.Set(k, v)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("oauth2 token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(secret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oauth2 token request: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("oauth2 token response: %w", err)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return fmt.Errorf("oauth2 token response: %s", resp.Status)
+	}
+	if resp.StatusCode/100 != 2 || body.AccessToken == "" {
+		if body.Error != "" {
+			return fmt.Errorf("oauth2 token request: %s: %s %s", resp.Status, body.Error, body.Description)
+		}
+		return fmt.Errorf("oauth2 token request: %s", resp.Status)
+	}
+	if body.TokenType != "" && !strings.EqualFold(body.TokenType, "bearer") {
+		return fmt.Errorf("oauth2 token type %q is not supported", body.TokenType)
+	}
+
+	o.token = body.AccessToken
+	o.expires = time.Now().Add(time.Hour)
+	if body.ExpiresIn > 0 {
+		o.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - tokenRefreshMargin)
+	}
+	return nil
+}
+
+func (o *oauth2Auth) RequireTransportSecurity() bool {
+	return o.requireTLS
+}
@@ -2,24 +2,30 @@ package gnmi
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
-	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math"
-	"os"
 	"time"
 
+	"github.com/jalapeno/config-pub/internal/certs"
 	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/credential"
 	"github.com/openconfig/gnmi/proto/gnmi"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
 type Collector struct {
 	global config.GNMIConfig
+	conns  *connManager
+	creds  *credential.Store
 }
 
 type ConfigMessage struct {
@@ -29,6 +35,10 @@ type ConfigMessage struct {
 	Encoding  string         `json:"encoding"`
 	Type      string         `json:"type"`
 	Updates   []ConfigUpdate `json:"updates"`
+	Errors    []CollectError `json:"errors,omitempty"`
+
+	// CollectionDuration travels in the Kafka envelope, not the payload.
+	CollectionDuration time.Duration `json:"-"`
 }
 
 type ConfigUpdate struct {
@@ -37,80 +47,184 @@ type ConfigUpdate struct {
 	Type  string      `json:"value_type"`
 }
 
-func NewCollector(cfg config.GNMIConfig) *Collector {
-	return &Collector{global: cfg}
+// CollectError records a subtree that could not be collected while the rest
+// of the host's config was.
+type CollectError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func NewCollector(cfg config.GNMIConfig, watcher *certs.Watcher) *Collector {
+	return &Collector{global: cfg, conns: newConnManager(watcher), creds: credential.NewStore()}
 }
 
+// Collect fetches the host's config, retrying once with fresh credentials
+// if the device rejects them.
 func (c *Collector) Collect(ctx context.Context, host config.HostResolved) (*ConfigMessage, error) {
-	conn, err := dial(ctx, host)
+	var msg *ConfigMessage
+	err := c.creds.WithRetry(ctx, host, isAuthError, func(creds credential.Credentials) error {
+		var err error
+		msg, err = c.collect(ctx, withCredentials(host, creds))
+		if isAuthError(err) {
+			// Dropping the connection also drops cached tokens of the auth mode.
+			c.conns.invalidate(host.Name)
+		}
+		return err
+	})
+	return msg, err
+}
+
+func withCredentials(host config.HostResolved, creds credential.Credentials) config.HostResolved {
+	host.Username = creds.Username
+	host.Password = creds.Password
+	return host
+}
+
+func isAuthError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Collector) collect(ctx context.Context, host config.HostResolved) (*ConfigMessage, error) {
+	start := time.Now()
+	conn, err := c.conns.get(ctx, host)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
 	client := gnmi.NewGNMIClient(conn)
 
-	reqPaths, err := buildPaths(host.Paths)
+	msg := &ConfigMessage{
+		Target:   host.Target,
+		Address:  host.Address,
+		Encoding: host.Encoding,
+		Type:     host.Type,
+		Updates:  []ConfigUpdate{},
+	}
+
+	switch host.Strategy {
+	case StrategyPerPath:
+		err = collectPerPath(ctx, client, host, msg)
+	default:
+		err = collectSingle(ctx, client, host, msg)
+	}
 	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			c.conns.invalidate(host.Name)
+		}
 		return nil, err
 	}
+	msg.Timestamp = time.Now().UTC()
+	msg.CollectionDuration = time.Since(start)
 
-	req := &gnmi.GetRequest{
-		Prefix:   &gnmi.Path{Target: host.Target},
-		Path:     reqPaths,
-		Type:     parseGetType(host.Type),
-		Encoding: parseEncoding(host.Encoding),
+	if len(msg.Updates) == 0 {
+		msg.Updates = append(msg.Updates, ConfigUpdate{
+			Path:  "/",
+			Value: json.RawMessage("{}"),
+			Type:  "empty",
+		})
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, host.RequestTimeout)
-	defer cancel()
+	return msg, nil
+}
+
+func collectSingle(ctx context.Context, client gnmi.GNMIClient, host config.HostResolved, msg *ConfigMessage) error {
+	reqPaths, err := buildPaths(host.Paths)
+	if err != nil {
+		return err
+	}
 
-	resp, err := client.Get(ctx, req)
+	resp, err := get(ctx, client, host, getRequest{paths: reqPaths})
 	if err != nil {
-		return nil, err
+		return err
 	}
+	msg.appendResponse(resp)
+	return nil
+}
 
-	msg := &ConfigMessage{
-		Timestamp: time.Now().UTC(),
-		Target:    host.Target,
-		Address:   host.Address,
-		Encoding:  host.Encoding,
-		Type:      host.Type,
-		Updates:   []ConfigUpdate{},
+func get(ctx context.Context, client gnmi.GNMIClient, host config.HostResolved, r getRequest) (*gnmi.GetResponse, error) {
+	req := &gnmi.GetRequest{
+		Prefix:    &gnmi.Path{Target: host.Target},
+		Path:      r.paths,
+		Type:      parseGetType(host.Type),
+		Encoding:  parseEncoding(host.Encoding),
+		UseModels: r.models,
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, host.RequestTimeout)
+	defer cancel()
+
+	return client.Get(ctx, req)
+}
+
+func (m *ConfigMessage) appendResponse(resp *gnmi.GetResponse) {
 	for _, notification := range resp.Notification {
 		for _, update := range notification.Update {
 			path := gnmiPathToString(update.Path)
 			value, valueType := typedValueToInterface(update.Val)
-			msg.Updates = append(msg.Updates, ConfigUpdate{
+			m.Updates = append(m.Updates, ConfigUpdate{
 				Path:  path,
 				Value: value,
 				Type:  valueType,
 			})
 		}
 	}
+}
 
-	if len(msg.Updates) == 0 {
-		msg.Updates = append(msg.Updates, ConfigUpdate{
-			Path:  "/",
-			Value: json.RawMessage("{}"),
-			Type:  "empty",
-		})
+// ConfigHash digests the collected updates only, so two collections of an
+// unchanged config hash the same regardless of timestamp.
+func (m *ConfigMessage) ConfigHash() string {
+	raw, err := json.Marshal(m.Updates)
+	if err != nil {
+		return ""
 	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
 
-	return msg, nil
+// Invalidate closes the cached connection for a host so the next Collect
+// dials again.
+func (c *Collector) Invalidate(name string) {
+	c.conns.invalidate(name)
+}
+
+// Retain closes cached connections for hosts that are no longer in the
+// inventory.
+func (c *Collector) Retain(names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	c.conns.retain(keep)
 }
 
-func dial(ctx context.Context, host config.HostResolved) (*grpc.ClientConn, error) {
-	creds, err := buildCredentials(host)
+func (c *Collector) Close() error {
+	return c.conns.close()
+}
+
+func dial(ctx context.Context, host config.HostResolved, watcher *certs.Watcher) (*grpc.ClientConn, error) {
+	creds, err := buildCredentials(host, watcher)
 	if err != nil {
 		return nil, err
 	}
 
-	options := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
-	if host.Username != "" || host.Password != "" {
-		options = append(options, grpc.WithPerRPCCredentials(newBasicAuth(host.Username, host.Password, !host.Insecure)))
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepaliveParams(host.Keepalive)),
+	}
+	if host.MaxRecvMsgSize > 0 {
+		options = append(options, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(host.MaxRecvMsgSize)))
+	}
+	perRPC, err := perRPCCredentials(host)
+	if err != nil {
+		return nil, err
+	}
+	if perRPC != nil {
+		options = append(options, grpc.WithPerRPCCredentials(perRPC))
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, host.DialTimeout)
@@ -119,38 +233,45 @@ func dial(ctx context.Context, host config.HostResolved) (*grpc.ClientConn, erro
 	return grpc.DialContext(ctx, host.Address, options...)
 }
 
-func buildCredentials(host config.HostResolved) (credentials.TransportCredentials, error) {
+func buildCredentials(host config.HostResolved, watcher *certs.Watcher) (credentials.TransportCredentials, error) {
 	if host.Insecure {
 		return insecure.NewCredentials(), nil
 	}
 
+	minVersion, err := parseTLSVersion(host.TLS.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := watcher.Get(host.TLS)
+	if err != nil {
+		return nil, err
+	}
 	tlsConfig := &tls.Config{
+		ServerName:         host.TLS.ServerName,
+		MinVersion:         minVersion,
+		RootCAs:            bundle.RootCAs,
 		InsecureSkipVerify: host.TLS.InsecureSkipVerify,
 	}
-
-	if host.TLS.CAFile != "" {
-		caCert, err := os.ReadFile(host.TLS.CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("read CA file: %w", err)
-		}
-		caPool := x509.NewCertPool()
-		if !caPool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("append CA certificate: %w", err)
-		}
-		tlsConfig.RootCAs = caPool
-	}
-
-	if host.TLS.CertFile != "" || host.TLS.KeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(host.TLS.CertFile, host.TLS.KeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("load client certificate: %w", err)
-		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
+	if bundle.Certificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*bundle.Certificate}
 	}
 
 	return credentials.NewTLS(tlsConfig), nil
 }
 
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls min_version %q (use 1.2 or 1.3)", version)
+	}
+}
+
 func parseEncoding(enc string) gnmi.Encoding {
 	switch enc {
 	case "json":
@@ -0,0 +1,190 @@
+package gnmi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/certs"
+	"github.com/jalapeno/config-pub/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+// connManager keeps one long-lived gRPC connection per host so collection
+// cycles reuse the TLS session instead of re-dialing every time.
+type connManager struct {
+	certs *certs.Watcher
+
+	mu    sync.Mutex
+	conns map[string]*managedConn
+}
+
+type managedConn struct {
+	conn *grpc.ClientConn
+	key  dialKey
+}
+
+// dialKey holds every host setting that affects how a connection is built.
+// A host whose key changes gets a fresh connection.
+type dialKey struct {
+	Address        string
+	Username       string
+	Password       string
+	Auth           string
+	Insecure       bool
+	DialTimeout    time.Duration
+	Keepalive      config.Keepalive
+	MaxRecvMsgSize int
+	TLS            config.TLSConfig
+	TLSGeneration  uint64
+}
+
+func newConnManager(watcher *certs.Watcher) *connManager {
+	return &connManager{certs: watcher, conns: map[string]*managedConn{}}
+}
+
+// dialKey includes the generation of the host's TLS files, so reloaded
+// certificates replace the connection.
+func (m *connManager) dialKey(host config.HostResolved) dialKey {
+	key := dialKey{
+		Address:        host.Address,
+		Username:       host.Username,
+		Password:       host.Password,
+		Auth:           authKey(host.Auth),
+		Insecure:       host.Insecure,
+		DialTimeout:    host.DialTimeout,
+		Keepalive:      host.Keepalive,
+		MaxRecvMsgSize: host.MaxRecvMsgSize,
+		TLS:            host.TLS,
+	}
+	if !host.Insecure {
+		if bundle, err := m.certs.Get(host.TLS); err == nil {
+			key.TLSGeneration = bundle.Generation
+		}
+	}
+	return key
+}
+
+// authKey flattens the auth settings, which hold slices and maps, into a
+// comparable value. It is only compared, never logged.
+func authKey(auth *config.AuthConfig) string {
+	if auth == nil {
+		return ""
+	}
+	return fmt.Sprintf("%#v", *auth)
+}
+
+func (m *connManager) get(ctx context.Context, host config.HostResolved) (*grpc.ClientConn, error) {
+	key := m.dialKey(host)
+
+	m.mu.Lock()
+	entry, ok := m.conns[host.Name]
+	if ok && entry.key != key {
+		log.Printf("gnmi settings changed for %s; reconnecting", host.Name)
+		delete(m.conns, host.Name)
+		entry.conn.Close()
+		ok = false
+	}
+	m.mu.Unlock()
+
+	if ok {
+		err := waitReady(ctx, entry.conn, host.DialTimeout)
+		if err == nil {
+			return entry.conn, nil
+		}
+		log.Printf("gnmi connection to %s (%s) unhealthy: %v; reconnecting", host.Name, host.Address, err)
+		m.drop(host.Name, entry.conn)
+	}
+
+	conn, err := dial(ctx, host, m.certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitReady(ctx, conn, host.DialTimeout); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect %s: %w", host.Address, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.conns[host.Name]; ok && existing.key == key {
+		conn.Close()
+		return existing.conn, nil
+	}
+	m.conns[host.Name] = &managedConn{conn: conn, key: key}
+	return conn, nil
+}
+
+func (m *connManager) drop(name string, conn *grpc.ClientConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.conns[name]; ok && entry.conn == conn {
+		delete(m.conns, name)
+	}
+	conn.Close()
+}
+
+func (m *connManager) invalidate(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.conns[name]; ok {
+		delete(m.conns, name)
+		entry.conn.Close()
+	}
+}
+
+func (m *connManager) retain(names map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, entry := range m.conns {
+		if !names[name] {
+			delete(m.conns, name)
+			entry.conn.Close()
+		}
+	}
+}
+
+func (m *connManager) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var firstErr error
+	for name, entry := range m.conns {
+		if err := entry.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.conns, name)
+	}
+	return firstErr
+}
+
+func waitReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return fmt.Errorf("connection shut down")
+		case connectivity.Idle:
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connection not ready (state %s): %w", state, ctx.Err())
+		}
+	}
+}
+
+func keepaliveParams(cfg config.Keepalive) keepalive.ClientParameters {
+	return keepalive.ClientParameters{
+		Time:                cfg.Time,
+		Timeout:             cfg.Timeout,
+		PermitWithoutStream: false,
+	}
+}
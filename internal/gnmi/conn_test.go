@@ -0,0 +1,187 @@
+package gnmi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/certs"
+	"github.com/jalapeno/config-pub/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String()
+}
+
+func TestConnManagerDialKey(t *testing.T) {
+	addr := startServer(t)
+	base := config.HostResolved{
+		Name:        "r1",
+		Address:     addr,
+		Username:    "admin",
+		Password:    "admin",
+		Insecure:    true,
+		DialTimeout: 5 * time.Second,
+		Keepalive:   config.Keepalive{Time: time.Minute, Timeout: 20 * time.Second},
+		Auth:        &config.AuthConfig{Mode: AuthOAuth2, OAuth2: config.OAuth2Config{TokenURL: "https://idp/token", ClientID: "config-pub", Params: map[string]string{"audience": "gnmi", "scope": "read"}}},
+	}
+
+	tests := []struct {
+		name      string
+		change    func(h *config.HostResolved)
+		reconnect bool
+	}{
+		{name: "same settings", change: func(h *config.HostResolved) {}},
+		{name: "equal auth", change: func(h *config.HostResolved) {
+			h.Auth = &config.AuthConfig{Mode: AuthOAuth2, OAuth2: config.OAuth2Config{TokenURL: "https://idp/token", ClientID: "config-pub", Params: map[string]string{"scope": "read", "audience": "gnmi"}}}
+		}},
+		// The schedule does not affect the connection.
+		{name: "schedule", change: func(h *config.HostResolved) { h.Schedule = "*/5 * * * *" }},
+		{name: "password", change: func(h *config.HostResolved) { h.Password = "rotated" }, reconnect: true},
+		{name: "auth params", change: func(h *config.HostResolved) { h.Auth.OAuth2.Params = map[string]string{"audience": "other"} }, reconnect: true},
+		{name: "keepalive", change: func(h *config.HostResolved) { h.Keepalive.Time = 2 * time.Minute }, reconnect: true},
+		{name: "max message size", change: func(h *config.HostResolved) { h.MaxRecvMsgSize = 64 << 20 }, reconnect: true},
+		{name: "tls settings", change: func(h *config.HostResolved) { h.TLS.ServerName = "r1.example" }, reconnect: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newConnManager(certs.NewWatcher(config.CertificatesConfig{}))
+			defer m.close()
+			ctx := context.Background()
+
+			host := base
+			first, err := m.get(ctx, host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := *base.Auth
+			host.Auth = &auth
+			tt.change(&host)
+			second, err := m.get(ctx, host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reconnected := first != second; reconnected != tt.reconnect {
+				t.Fatalf("reconnected %v, want %v", reconnected, tt.reconnect)
+			}
+			if tt.reconnect && first.GetState() != connectivity.Shutdown {
+				t.Errorf("replaced connection is %s, want it closed", first.GetState())
+			}
+		})
+	}
+}
+
+func TestConnManagerInvalidate(t *testing.T) {
+	addr := startServer(t)
+	m := newConnManager(certs.NewWatcher(config.CertificatesConfig{}))
+	defer m.close()
+	ctx := context.Background()
+	hosts := []config.HostResolved{
+		{Name: "r1", Address: addr, Insecure: true, DialTimeout: 5 * time.Second},
+		{Name: "r2", Address: addr, Insecure: true, DialTimeout: 5 * time.Second},
+	}
+	conns := make([]*grpc.ClientConn, len(hosts))
+	for i, host := range hosts {
+		conn, err := m.get(ctx, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = conn
+	}
+
+	m.invalidate("r1")
+	if conns[0].GetState() != connectivity.Shutdown {
+		t.Errorf("invalidated connection is %s, want it closed", conns[0].GetState())
+	}
+	if conn, err := m.get(ctx, hosts[0]); err != nil || conn == conns[0] {
+		t.Errorf("r1 after invalidate: err %v, reused %v", err, conn == conns[0])
+	}
+
+	m.retain(map[string]bool{"r1": true})
+	if conns[1].GetState() != connectivity.Shutdown {
+		t.Errorf("connection of removed host is %s, want it closed", conns[1].GetState())
+	}
+	if _, ok := m.conns["r2"]; ok {
+		t.Error("r2 still cached after retain")
+	}
+}
+
+func TestDialKeyTLSGeneration(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA(t, caFile, 1)
+
+	watcher := certs.NewWatcher(config.CertificatesConfig{CheckInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx)
+
+	m := newConnManager(watcher)
+	host := config.HostResolved{Name: "r1", Address: "192.0.2.1:57400", TLS: config.TLSConfig{CAFile: caFile}}
+	before := m.dialKey(host)
+	if before.TLSGeneration == 0 {
+		t.Fatal("no TLS generation for a loaded CA")
+	}
+	if m.dialKey(host) != before {
+		t.Fatal("dial key changed without a reload")
+	}
+
+	// A rotated CA file is reloaded and changes the key, so the next
+	// collection dials with it.
+	writeCA(t, caFile, 2)
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(caFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.dialKey(host) == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.dialKey(host) == before {
+		t.Error("dial key unchanged after the CA file was replaced")
+	}
+}
+
+func writeCA(t *testing.T, path string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -14,7 +14,7 @@ var keyRegex = regexp.MustCompile(`\[([^=\]]+)=([^\]]+)\]`)
 func buildPaths(paths []string) ([]*gnmi.Path, error) {
 	out := make([]*gnmi.Path, 0, len(paths))
 	for _, raw := range paths {
-		path, err := parsePath(raw)
+		path, err := ParsePath(raw)
 		if err != nil {
 			return nil, err
 		}
@@ -23,7 +23,8 @@ func buildPaths(paths []string) ([]*gnmi.Path, error) {
 	return out, nil
 }
 
-func parsePath(raw string) (*gnmi.Path, error) {
+// ParsePath parses a path such as "/mod:a/b[name=x]"; "/" is the root.
+func ParsePath(raw string) (*gnmi.Path, error) {
 	clean := strings.TrimSpace(raw)
 	if clean == "" || clean == "/" {
 		return &gnmi.Path{}, nil
@@ -0,0 +1,121 @@
+package gnmi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	StrategySingle  = "single"
+	StrategyPerPath = "per_path"
+)
+
+type getRequest struct {
+	label  string
+	paths  []*gnmi.Path
+	models []*gnmi.ModelData
+}
+
+// collectPerPath issues one Get per configured path (or per model when the
+// root is expanded) and merges the results. Failed subtrees are recorded on
+// the message; the host only fails when nothing could be collected.
+func collectPerPath(ctx context.Context, client gnmi.GNMIClient, host config.HostResolved, msg *ConfigMessage) error {
+	reqs, err := splitRequests(ctx, client, host, msg)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	var firstErr error
+	for _, r := range reqs {
+		resp, err := get(ctx, client, host, r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if status.Code(err) == codes.Unavailable {
+				return err
+			}
+			log.Printf("get %s failed for %s (%s): %v", r.label, host.Name, host.Address, err)
+			msg.Errors = append(msg.Errors, CollectError{Path: r.label, Error: err.Error()})
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msg.appendResponse(resp)
+	}
+
+	if failed == len(reqs) && firstErr != nil {
+		return fmt.Errorf("all %d requests failed: %w", len(reqs), firstErr)
+	}
+	return nil
+}
+
+func splitRequests(ctx context.Context, client gnmi.GNMIClient, host config.HostResolved, msg *ConfigMessage) ([]getRequest, error) {
+	reqs := make([]getRequest, 0, len(host.Paths))
+	for _, raw := range host.Paths {
+		path, err := ParsePath(raw)
+		if err != nil {
+			return nil, err
+		}
+		if host.ExpandRoot && len(path.Elem) == 0 {
+			expanded, err := expandRoot(ctx, client, host)
+			if err == nil && len(expanded) > 0 {
+				reqs = append(reqs, expanded...)
+				continue
+			}
+			if err != nil {
+				log.Printf("expand root failed for %s (%s): %v; requesting / as a whole", host.Name, host.Address, err)
+				msg.Errors = append(msg.Errors, CollectError{Path: "capabilities", Error: err.Error()})
+			}
+		}
+		reqs = append(reqs, getRequest{label: gnmiPathToString(path), paths: []*gnmi.Path{path}})
+	}
+	return reqs, nil
+}
+
+// expandRoot turns a root Get into one Get per model advertised in the
+// target's Capabilities, scoped with use_models.
+func expandRoot(ctx context.Context, client gnmi.GNMIClient, host config.HostResolved) ([]getRequest, error) {
+	var filter *regexp.Regexp
+	if host.ModelFilter != "" {
+		var err error
+		filter, err = regexp.Compile(host.ModelFilter)
+		if err != nil {
+			return nil, fmt.Errorf("model_filter: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, host.RequestTimeout)
+	defer cancel()
+
+	caps, err := client.Capabilities(ctx, &gnmi.CapabilityRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("capabilities: %w", err)
+	}
+
+	reqs := []getRequest{}
+	for _, model := range caps.SupportedModels {
+		if model == nil || model.Name == "" {
+			continue
+		}
+		if filter != nil && !filter.MatchString(model.Name) {
+			continue
+		}
+		reqs = append(reqs, getRequest{
+			label:  model.Name,
+			paths:  []*gnmi.Path{{}},
+			models: []*gnmi.ModelData{{Name: model.Name, Organization: model.Organization, Version: model.Version}},
+		})
+	}
+	return reqs, nil
+}
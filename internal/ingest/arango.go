@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"sync"
+	"time"
 
 	driver "github.com/arangodb/go-driver"
-	"github.com/arangodb/go-driver/http"
 )
 
 const (
@@ -17,141 +19,273 @@ const (
 )
 
 type ArangoConfig struct {
-	URL           string
-	Database      string
-	User          string
-	Password      string
-	UserFile      string
-	PassFile      string
-	IGPCollection string
-	BGPCollection string
+	URL string
+	// Endpoints are further coordinators; requests fail over between URL
+	// and these.
+	Endpoints []string
+	Database  string
+	User      string
+	Password  string
+	UserFile  string
+	PassFile  string
+
+	// Auth is "basic" (default), "jwt" (log in with the user and password)
+	// or "token" (a JWT from Token or TokenFile, re-read on reconnect).
+	Auth      string
+	Token     string
+	TokenFile string
+
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Timeout bounds connecting and each request (default 30s).
+	Timeout time.Duration
+
+	Matchers []Matcher
+	// Bootstrap creates missing collections and indexes; Wait is how long
+	// to retry while the database is unavailable.
+	Bootstrap bool
+	Wait      time.Duration
+	// History is the collection configs are versioned in, empty for none;
+	// HistoryVersions is how many versions per target it keeps (0 for all).
+	History         string
+	HistoryVersions int
+	// KeepNewer leaves documents whose config_ts is newer than the update's
+	// alone, so replaying old payloads cannot undo live updates.
+	KeepNewer bool
 }
 
 type ArangoClient struct {
-	db            driver.Database
-	igpCollection driver.Collection
-	bgpCollection driver.Collection
+	cfg      ArangoConfig
+	matchers []Matcher
+
+	mu sync.Mutex
+	db driver.Database
 }
 
 func NewArangoClient(cfg ArangoConfig) (*ArangoClient, error) {
-	if cfg.UserFile == "" {
-		cfg.UserFile = defaultUserFile
+	ctx := context.Background()
+	db, err := WaitDatabase(ctx, cfg, cfg.Wait)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.PassFile == "" {
-		cfg.PassFile = defaultPassFile
+
+	if cfg.Bootstrap {
+		if err := Bootstrap(ctx, db, cfg.Matchers); err != nil {
+			return nil, fmt.Errorf("bootstrap: %w", err)
+		}
 	}
-	if cfg.User == "" || cfg.Password == "" {
-		user, pass, err := readCredentials(cfg.UserFile, cfg.PassFile)
-		if err != nil {
-			return nil, err
+	for _, m := range cfg.Matchers {
+		if _, err := db.Collection(ctx, m.Collection); err != nil {
+			return nil, fmt.Errorf("%s collection: %w", m.Collection, err)
 		}
-		cfg.User = user
-		cfg.Password = pass
 	}
-	conn, err := http.NewConnection(http.ConnectionConfig{Endpoints: []string{cfg.URL}})
+	if cfg.History != "" {
+		if cfg.Bootstrap {
+			err = BootstrapHistory(ctx, db, cfg.History)
+		} else {
+			_, err = db.Collection(ctx, cfg.History)
+		}
+		if err != nil && driver.IsNotFound(err) {
+			log.Printf("%s collection missing, not keeping config history (run with -bootstrap to create it)", cfg.History)
+			cfg.History = ""
+		} else if err != nil {
+			return nil, fmt.Errorf("%s collection: %w", cfg.History, err)
+		}
+	}
+
+	return &ArangoClient{
+		cfg:      cfg,
+		db:       db,
+		matchers: cfg.Matchers,
+	}, nil
+}
+
+// OpenDatabase connects to Arango with the connection and credential
+// handling shared by config-ingest and config-pub. Basic and JWT auth use
+// the explicit user/password, otherwise the username and password files.
+func OpenDatabase(cfg ArangoConfig) (driver.Database, error) {
+	auth, err := authentication(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connection(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("arango connection: %w", err)
 	}
 	client, err := driver.NewClient(driver.ClientConfig{
 		Connection:     conn,
-		Authentication: driver.BasicAuthentication(cfg.User, cfg.Password),
+		Authentication: auth,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("arango client: %w", err)
 	}
-	db, err := client.Database(context.Background(), cfg.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout(cfg))
+	defer cancel()
+	db, err := client.Database(ctx, cfg.Database)
 	if err != nil {
 		return nil, fmt.Errorf("arango database: %w", err)
 	}
+	return db, nil
+}
 
-	igp, err := db.Collection(context.Background(), cfg.IGPCollection)
-	if err != nil {
-		return nil, fmt.Errorf("igp collection: %w", err)
-	}
-	bgp, err := db.Collection(context.Background(), cfg.BGPCollection)
-	if err != nil {
-		return nil, fmt.Errorf("bgp collection: %w", err)
-	}
+// Result is what one matcher did with a payload. Updated counts the
+// documents written and Newer those kept because they hold a newer config;
+// Skipped says why the matcher did not apply.
+type Result struct {
+	Collection string
+	Match      Match
+	Updated    int
+	Newer      int
+	Skipped    string
+	Err        error
+}
 
-	return &ArangoClient{
-		db:            db,
-		igpCollection: igp,
-		bgpCollection: bgp,
-	}, nil
+// Update writes the payload's update to every matcher's collection. Within
+// a collection the candidates are tried in order and the first that matches
+// any document updates all the documents it matches, recording itself under
+// config_match.
+func (c *ArangoClient) Update(ctx context.Context, info MatchInfo, candidates []Match, update map[string]interface{}) []Result {
+	results := make([]Result, 0, len(c.matchers))
+	for _, m := range c.matchers {
+		result := Result{Collection: m.Collection}
+		if ok, reason := m.Applies(info); !ok {
+			result.Skipped = reason
+		} else {
+			result.Match, result.Updated, result.Newer, result.Err = c.updateMatch(ctx, m, info.BGPASN, candidates, update)
+		}
+		results = append(results, result)
+	}
+	return results
 }
 
-func (c *ArangoClient) UpdateIGP(ctx context.Context, routerID, hostname string, update map[string]interface{}) (bool, error) {
-	query := `
+func (c *ArangoClient) updateMatch(ctx context.Context, m Matcher, asn int, candidates []Match, update map[string]interface{}) (Match, int, int, error) {
+	for _, candidate := range candidates {
+		filter, ok := m.filter(candidate.Key)
+		if !ok {
+			continue
+		}
+		withMatch := make(map[string]interface{}, len(update)+1)
+		for k, v := range update {
+			withMatch[k] = v
+		}
+		withMatch["config_match"] = candidate
+
+		guard := ""
+		if c.cfg.KeepNewer {
+			guard = `
+	FILTER n.config_ts == null OR DATE_TIMESTAMP(n.config_ts) <= DATE_TIMESTAMP(@update.config_ts)`
+		}
+		query := `
 FOR n IN @@collection
-	FILTER n.router_id == @router_id
+	FILTER ` + filter + guard + `
 	UPDATE n WITH @update IN @@collection OPTIONS { keepNull: false }
 	RETURN NEW._key
 `
-	bindVars := map[string]interface{}{
-		"@collection": c.igpCollection.Name(),
-		"router_id":   routerID,
-		"update":      update,
-	}
-	if routerID == "" && hostname != "" {
-		query = `
+		bindVars := map[string]interface{}{
+			"@collection": m.Collection,
+			"value":       candidate.Value,
+			"update":      withMatch,
+		}
+		if m.ASNField != "" {
+			bindVars["asn"] = asn
+		}
+		n, err := c.updateAll(ctx, query, bindVars)
+		if err != nil {
+			return candidate, 0, 0, err
+		}
+		if n > 0 {
+			return candidate, n, 0, nil
+		}
+		if guard == "" {
+			continue
+		}
+
+		// Nothing written: the candidate matched nothing, or only newer
+		// documents, which ends the search like an update would.
+		delete(bindVars, "update")
+		newer, err := c.updateAll(ctx, `
 FOR n IN @@collection
-	FILTER n.name == @name
-	UPDATE n WITH @update IN @@collection OPTIONS { keepNull: false }
-	RETURN NEW._key
-`
-		bindVars = map[string]interface{}{
-			"@collection": c.igpCollection.Name(),
-			"name":        hostname,
-			"update":      update,
+	FILTER `+filter+`
+	RETURN n._key
+`, bindVars)
+		if err != nil {
+			return candidate, 0, 0, err
+		}
+		if newer > 0 {
+			return candidate, 0, newer, nil
 		}
 	}
+	return Match{}, 0, 0, nil
+}
 
-	cursor, err := c.db.Query(ctx, query, bindVars)
-	if err != nil {
-		return false, err
+// updateAll runs a query and counts the documents it returns. When
+// Arango is unreachable or restarted, e.g. invalidating the JWT, it
+// reconnects with backoff for up to the configured wait and tries again.
+func (c *ArangoClient) updateAll(ctx context.Context, query string, bindVars map[string]interface{}) (int, error) {
+	deadline := time.Now().Add(c.cfg.Wait)
+	delay := minRetry
+	for {
+		n, err := c.tryUpdateAll(ctx, query, bindVars)
+		if err == nil || ctx.Err() != nil || !reconnectable(err, authMode(c.cfg)) || time.Now().Add(delay).After(deadline) {
+			return n, err
+		}
+		log.Printf("arango request failed, reconnecting in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+		if err := c.reconnect(); err != nil {
+			log.Printf("arango reconnect: %v", err)
+		}
+		delay *= 2
+		if delay > maxRetry {
+			delay = maxRetry
+		}
 	}
-	defer cursor.Close()
+}
 
-	var key string
-	_, err = cursor.ReadDocument(ctx, &key)
-	if driver.IsNoMoreDocuments(err) {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-	return true, nil
+func (c *ArangoClient) database() driver.Database {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db
 }
 
-func (c *ArangoClient) UpdateBGP(ctx context.Context, routerID string, asn int, update map[string]interface{}) (bool, error) {
-	query := `
-FOR n IN @@collection
-	FILTER n.router_id == @router_id AND n.asn == @asn
-	UPDATE n WITH @update IN @@collection OPTIONS { keepNull: false }
-	RETURN NEW._key
-`
-	bindVars := map[string]interface{}{
-		"@collection": c.bgpCollection.Name(),
-		"router_id":   routerID,
-		"asn":         asn,
-		"update":      update,
+func (c *ArangoClient) reconnect() error {
+	db, err := OpenDatabase(c.cfg)
+	if err != nil {
+		return err
 	}
+	c.mu.Lock()
+	c.db = db
+	c.mu.Unlock()
+	return nil
+}
 
-	cursor, err := c.db.Query(ctx, query, bindVars)
+func (c *ArangoClient) tryUpdateAll(ctx context.Context, query string, bindVars map[string]interface{}) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(c.cfg))
+	defer cancel()
+	cursor, err := c.database().Query(ctx, query, bindVars)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 	defer cursor.Close()
 
-	var key string
-	_, err = cursor.ReadDocument(ctx, &key)
-	if driver.IsNoMoreDocuments(err) {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
+	n := 0
+	for {
+		var key string
+		_, err = cursor.ReadDocument(ctx, &key)
+		if driver.IsNoMoreDocuments(err) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
 	}
-	return true, nil
 }
 
 func readCredentials(userFile, passFile string) (string, string, error) {
@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+const (
+	// ConfigHashField holds the hash of the stored running config.
+	ConfigHashField = "config_hash"
+
+	indexPrefix = "config_ingest_"
+
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// WaitDatabase opens the database, retrying with backoff for up to wait
+// while Arango or the database is not there yet. A zero wait tries once.
+func WaitDatabase(ctx context.Context, cfg ArangoConfig, wait time.Duration) (driver.Database, error) {
+	deadline := time.Now().Add(wait)
+	delay := minRetry
+	for {
+		db, err := OpenDatabase(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if wait <= 0 || time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+		log.Printf("arango not ready, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRetry {
+			delay = maxRetry
+		}
+	}
+}
+
+// Bootstrap creates the matchers' collections when missing and ensures
+// sparse persistent indexes on the fields they filter on, plus the config
+// hash. Existing collections and indexes are left as they are.
+func Bootstrap(ctx context.Context, db driver.Database, matchers []Matcher) error {
+	for _, m := range matchers {
+		exists, err := db.CollectionExists(ctx, m.Collection)
+		if err != nil {
+			return fmt.Errorf("%s collection: %w", m.Collection, err)
+		}
+		var col driver.Collection
+		if exists {
+			col, err = db.Collection(ctx, m.Collection)
+		} else {
+			col, err = db.CreateCollection(ctx, m.Collection, nil)
+			if err == nil {
+				log.Printf("created collection %s", m.Collection)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s collection: %w", m.Collection, err)
+		}
+
+		for _, field := range indexFields(m) {
+			_, created, err := col.EnsurePersistentIndex(ctx, []string{field}, &driver.EnsurePersistentIndexOptions{
+				Name:         indexName(field),
+				Sparse:       true,
+				InBackground: true,
+			})
+			if err != nil {
+				return fmt.Errorf("%s index on %s: %w", m.Collection, field, err)
+			}
+			if created {
+				log.Printf("created index on %s.%s", m.Collection, field)
+			}
+		}
+	}
+	return nil
+}
+
+func indexFields(m Matcher) []string {
+	seen := map[string]bool{ConfigHashField: true}
+	if m.ASNField != "" {
+		seen[m.ASNField] = true
+	}
+	for _, field := range m.Fields {
+		seen[field] = true
+	}
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func indexName(field string) string {
+	return indexPrefix + strings.NewReplacer("[*]", "", ".", "_").Replace(field)
+}
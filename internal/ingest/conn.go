@@ -0,0 +1,213 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/arangodb/go-driver/http"
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+// Arango authentication modes.
+const (
+	AuthBasic = "basic"
+	AuthJWT   = "jwt"
+	AuthToken = "token"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	connLimit      = 32
+	maxToken       = 16 * 1024
+)
+
+// ArangoConfigFrom takes the connection settings of a config file.
+func ArangoConfigFrom(c config.ArangoConfig) ArangoConfig {
+	return ArangoConfig{
+		URL:                c.URL,
+		Endpoints:          c.Endpoints,
+		Database:           c.Database,
+		User:               c.User,
+		Password:           c.Password,
+		UserFile:           c.UserFile,
+		PassFile:           c.PassFile,
+		Auth:               c.Auth,
+		TokenFile:          c.TokenFile,
+		CAFile:             c.TLS.CAFile,
+		CertFile:           c.TLS.CertFile,
+		KeyFile:            c.TLS.KeyFile,
+		InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+		Timeout:            c.Timeout,
+	}
+}
+
+// endpoints lists URL then the further endpoints, without duplicates.
+func endpoints(cfg ArangoConfig) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, ep := range append([]string{cfg.URL}, cfg.Endpoints...) {
+		ep = strings.TrimSuffix(strings.TrimSpace(ep), "/")
+		if ep == "" || seen[ep] {
+			continue
+		}
+		seen[ep] = true
+		out = append(out, ep)
+	}
+	return out
+}
+
+func requestTimeout(cfg ArangoConfig) time.Duration {
+	if cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+	return defaultTimeout
+}
+
+// connection builds an HTTP connection over all endpoints; the driver fails
+// over to the next endpoint when one cannot be reached.
+func connection(cfg ArangoConfig) (driver.Connection, error) {
+	eps := endpoints(cfg)
+	if len(eps) == 0 {
+		return nil, errors.New("no arango endpoint")
+	}
+	tlsConfig, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := requestTimeout(cfg)
+	transport := &nethttp.Transport{
+		Proxy: nethttp.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   connLimit,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return http.NewConnection(http.ConnectionConfig{
+		Endpoints: eps,
+		Transport: transport,
+		ConnLimit: connLimit,
+	})
+}
+
+// tlsConfig trusts the CA file in addition to the system roots and presents
+// the client certificate when one is set.
+func tlsConfig(cfg ArangoConfig) (*tls.Config, error) {
+	out := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+		}
+		out.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("client certificate needs both a cert and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		out.Certificates = []tls.Certificate{cert}
+	}
+	return out, nil
+}
+
+// authentication picks the auth mode; a configured token implies token auth.
+// Basic and JWT read the username and password files when either value is
+// missing, the token is read from its file on every connect.
+func authentication(cfg ArangoConfig) (driver.Authentication, error) {
+	mode := authMode(cfg)
+	switch mode {
+	case "none":
+		return nil, nil
+	case AuthToken:
+		token := cfg.Token
+		if cfg.TokenFile != "" {
+			raw, err := readFile(cfg.TokenFile, maxToken)
+			if err != nil {
+				return nil, fmt.Errorf("read token: %w", err)
+			}
+			token = raw
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return nil, errors.New("token auth needs a token or token file")
+		}
+		return driver.RawAuthentication("bearer " + token), nil
+	case AuthBasic, AuthJWT:
+	default:
+		return nil, fmt.Errorf("unknown arango auth %q (want %s, %s, %s or none)", mode, AuthBasic, AuthJWT, AuthToken)
+	}
+
+	if cfg.UserFile == "" {
+		cfg.UserFile = defaultUserFile
+	}
+	if cfg.PassFile == "" {
+		cfg.PassFile = defaultPassFile
+	}
+	if cfg.User == "" || cfg.Password == "" {
+		user, pass, err := readCredentials(cfg.UserFile, cfg.PassFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.User = user
+		cfg.Password = pass
+	}
+	if mode == AuthJWT {
+		return driver.JWTAuthentication(cfg.User, cfg.Password), nil
+	}
+	return driver.BasicAuthentication(cfg.User, cfg.Password), nil
+}
+
+func authMode(cfg ArangoConfig) string {
+	if cfg.Auth != "" {
+		return cfg.Auth
+	}
+	if cfg.Token != "" || cfg.TokenFile != "" {
+		return AuthToken
+	}
+	return AuthBasic
+}
+
+// reconnectable tells whether an error may go away by reconnecting: Arango
+// being unreachable or restarting, or, with JWT or token auth, a token it no
+// longer accepts. Rejected basic credentials stay rejected.
+func reconnectable(err error, mode string) bool {
+	if err == nil {
+		return false
+	}
+	if driver.IsUnauthorized(err) {
+		return mode == AuthJWT || mode == AuthToken
+	}
+	if driver.IsNoLeaderOrOngoing(err) {
+		return true
+	}
+	var ae driver.ArangoError
+	if errors.As(err, &ae) {
+		return ae.Code == nethttp.StatusServiceUnavailable
+	}
+	// Anything else from the driver is a transport failure.
+	return !driver.IsArangoError(err)
+}
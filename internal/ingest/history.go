@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+// DefaultHistoryCollection keeps past configs per target.
+const DefaultHistoryCollection = "config_history"
+
+// HistoryEntry is one stored config version of a target.
+type HistoryEntry struct {
+	Target        string              `json:"target"`
+	Address       string              `json:"address,omitempty"`
+	ConfigHash    string              `json:"config_hash"`
+	ConfigTS      time.Time           `json:"config_ts"`
+	RunningConfig *gnmi.ConfigMessage `json:"running_config"`
+}
+
+// BootstrapHistory creates the history collection when missing, indexed on
+// target and config hash.
+func BootstrapHistory(ctx context.Context, db driver.Database, name string) error {
+	exists, err := db.CollectionExists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%s collection: %w", name, err)
+	}
+	var col driver.Collection
+	if exists {
+		col, err = db.Collection(ctx, name)
+	} else {
+		col, err = db.CreateCollection(ctx, name, nil)
+		if err == nil {
+			log.Printf("created collection %s", name)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s collection: %w", name, err)
+	}
+	for _, field := range []string{"target", ConfigHashField} {
+		_, created, err := col.EnsurePersistentIndex(ctx, []string{field}, &driver.EnsurePersistentIndexOptions{
+			Name:         indexName(field),
+			InBackground: true,
+		})
+		if err != nil {
+			return fmt.Errorf("%s index on %s: %w", name, field, err)
+		}
+		if created {
+			log.Printf("created index on %s.%s", name, field)
+		}
+	}
+	return nil
+}
+
+// RecordHistory stores the payload as a new version of its target when its
+// config differs from the newest stored one and is newer, then drops the
+// versions beyond the configured count. It reports whether it stored one.
+func (c *ArangoClient) RecordHistory(ctx context.Context, msg *gnmi.ConfigMessage) (bool, error) {
+	if c.cfg.History == "" || msg.Target == "" {
+		return false, nil
+	}
+	entry := HistoryEntry{
+		Target:        msg.Target,
+		Address:       msg.Address,
+		ConfigHash:    msg.ConfigHash(),
+		ConfigTS:      msg.Timestamp,
+		RunningConfig: msg,
+	}
+	n, err := c.updateAll(ctx, `
+LET last = FIRST(
+	FOR h IN @@history
+		FILTER h.target == @entry.target
+		SORT DATE_TIMESTAMP(h.config_ts) DESC
+		LIMIT 1
+		RETURN h
+)
+FILTER last == null OR (last.config_hash != @entry.config_hash AND DATE_TIMESTAMP(last.config_ts) < DATE_TIMESTAMP(@entry.config_ts))
+INSERT @entry INTO @@history
+RETURN NEW._key
+`, map[string]interface{}{
+		"@history": c.cfg.History,
+		"entry":    entry,
+	})
+	if err != nil || n == 0 || c.cfg.HistoryVersions <= 0 {
+		return n > 0, err
+	}
+
+	_, err = c.updateAll(ctx, `
+FOR h IN @@history
+	FILTER h.target == @target
+	SORT DATE_TIMESTAMP(h.config_ts) DESC
+	LIMIT @keep, 1000000
+	REMOVE h IN @@history
+	RETURN OLD._key
+`, map[string]interface{}{
+		"@history": c.cfg.History,
+		"target":   msg.Target,
+		"keep":     c.cfg.HistoryVersions,
+	})
+	return true, err
+}
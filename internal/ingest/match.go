@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Match keys, in the default priority order. Each names a value extracted
+// from the config; a matcher's Fields name the document field it is
+// compared with.
+const (
+	MatchRouterID     = "router_id"
+	MatchIPv6RouterID = "ipv6_router_id"
+	MatchSRv6Locator  = "srv6_locator"
+	MatchISISSystemID = "isis_system_id"
+	MatchHostname     = "hostname"
+)
+
+var MatchKeys = []string{MatchRouterID, MatchIPv6RouterID, MatchSRv6Locator, MatchISISSystemID, MatchHostname}
+
+// NodeFields are the node document fields each key is compared with.
+var NodeFields = map[string]string{
+	MatchRouterID:     "router_id",
+	MatchIPv6RouterID: "ipv6_router_id",
+	MatchSRv6Locator:  "sids[*].srv6_sid",
+	MatchISISSystemID: "igp_router_id",
+	MatchHostname:     "name",
+}
+
+// Match records which key matched a config to its node.
+type Match struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ParseMatchKeys validates a priority list such as "router_id,hostname".
+func ParseMatchKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return MatchKeys, nil
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := NodeFields[key]; !ok {
+			return nil, fmt.Errorf("unknown match key %q (want one of %s)", key, strings.Join(MatchKeys, ", "))
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate match key %q", key)
+		}
+		seen[key] = true
+	}
+	return keys, nil
+}
+
+// Candidates lists the values to match on, in the order of keys. Addresses
+// are in canonical form; an SRv6 locator matches the node's uN SID, the
+// locator address.
+func (info MatchInfo) Candidates(keys []string) []Match {
+	var out []Match
+	for _, key := range keys {
+		switch key {
+		case MatchRouterID:
+			out = appendMatch(out, key, info.RouterID)
+		case MatchIPv6RouterID:
+			out = appendMatch(out, key, canonicalAddr(info.IPv6RouterID))
+		case MatchSRv6Locator:
+			for _, locator := range info.SRv6Locators {
+				out = appendMatch(out, key, canonicalAddr(locator))
+			}
+		case MatchISISSystemID:
+			out = appendMatch(out, key, systemID(info.ISISNet))
+		case MatchHostname:
+			out = appendMatch(out, key, info.Hostname)
+		}
+	}
+	return out
+}
+
+func appendMatch(out []Match, key, value string) []Match {
+	if value == "" {
+		return out
+	}
+	return append(out, Match{Key: key, Value: value})
+}
+
+// Matcher kinds decide which payloads a collection receives.
+const (
+	// KindIGP takes IS-IS and OSPF routers, as igp_node and ls_node hold.
+	KindIGP = "igp"
+	// KindBGP takes BGP routers and also requires the document's asn.
+	KindBGP = "bgp"
+	// KindPeer takes BGP routers' sessions: every peer document whose
+	// local_bgp_id and local_asn are the router's.
+	KindPeer = "peer"
+	// KindNode takes every payload.
+	KindNode = "node"
+)
+
+// Matcher selects the documents of one collection a payload updates. Fields
+// maps match keys to document fields; keys without a field are not tried.
+// ASNField, when set, must also equal the payload's BGP ASN.
+type Matcher struct {
+	Collection string
+	Kind       string
+	Fields     map[string]string
+	ASNField   string
+}
+
+// NewMatcher returns the matcher of a kind for a collection.
+func NewMatcher(collection, kind string) (Matcher, error) {
+	m := Matcher{Collection: collection, Kind: kind, Fields: NodeFields}
+	switch kind {
+	case KindIGP, KindNode:
+	case KindBGP:
+		m.ASNField = "asn"
+	case KindPeer:
+		m.Fields = map[string]string{MatchRouterID: "local_bgp_id"}
+		m.ASNField = "local_asn"
+	default:
+		return Matcher{}, fmt.Errorf("unknown matcher kind %q for %s", kind, collection)
+	}
+	return m, nil
+}
+
+// defaultKinds are the kinds of the collections Jalapeno creates.
+var defaultKinds = map[string]string{
+	"igp_node": KindIGP,
+	"ls_node":  KindIGP,
+	"bgp_node": KindBGP,
+	"peer":     KindPeer,
+}
+
+// ParseMatchers reads "collection[:kind]" entries; the kind may be left out
+// for igp_node, ls_node, bgp_node and peer.
+func ParseMatchers(entries []string) ([]Matcher, error) {
+	matchers := make([]Matcher, 0, len(entries))
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		collection, kind, _ := strings.Cut(entry, ":")
+		if kind == "" {
+			kind = defaultKinds[collection]
+		}
+		if kind == "" {
+			return nil, fmt.Errorf("collection %q needs a kind (%s, %s, %s or %s)", collection, KindIGP, KindBGP, KindPeer, KindNode)
+		}
+		if seen[collection] {
+			return nil, fmt.Errorf("duplicate collection %q", collection)
+		}
+		seen[collection] = true
+		m, err := NewMatcher(collection, kind)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// Applies tells whether the payload belongs in the matcher's collection, and
+// why not when it does not.
+func (m Matcher) Applies(info MatchInfo) (bool, string) {
+	switch m.Kind {
+	case KindIGP:
+		if !info.HasISIS && !info.HasOSPF {
+			return false, "no IGP in config"
+		}
+	case KindBGP, KindPeer:
+		if !info.HasBGP {
+			return false, "no BGP in config"
+		}
+	}
+	if m.ASNField != "" && info.BGPASN == 0 {
+		return false, "missing BGP ASN"
+	}
+	return true, ""
+}
+
+// filter is the AQL condition for a key, with @value the candidate value.
+func (m Matcher) filter(key string) (string, bool) {
+	field, ok := m.Fields[key]
+	if !ok {
+		return "", false
+	}
+	cond := "n." + field + " == @value"
+	if strings.Contains(field, "[*]") {
+		cond = "@value IN n." + field
+	}
+	if m.ASNField != "" {
+		cond += " AND n." + m.ASNField + " == @asn"
+	}
+	return cond, true
+}
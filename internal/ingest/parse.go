@@ -2,18 +2,25 @@ package ingest
 
 import (
 	"fmt"
+	"net/netip"
 	"strings"
 
+	"github.com/jalapeno/config-pub/internal/cli"
 	"github.com/jalapeno/config-pub/internal/gnmi"
 )
 
 type MatchInfo struct {
-	Hostname string
-	RouterID string
-	MgmtIP   string
-	HasISIS  bool
-	HasBGP   bool
-	BGPASN   int
+	Hostname     string
+	RouterID     string
+	MgmtIP       string
+	Loopbacks    []string
+	IPv6RouterID string
+	SRv6Locators []string
+	ISISNet      string
+	HasISIS      bool
+	HasOSPF      bool
+	HasBGP       bool
+	BGPASN       int
 }
 
 func ExtractMatchInfo(updates []gnmi.ConfigUpdate) (MatchInfo, error) {
@@ -22,21 +29,33 @@ func ExtractMatchInfo(updates []gnmi.ConfigUpdate) (MatchInfo, error) {
 	for _, update := range updates {
 		path := strings.TrimSpace(update.Path)
 		switch {
-		case strings.HasSuffix(path, "/host-names"):
+		case update.Type == cli.ValueType:
+			if text, ok := update.Value.(string); ok {
+				extractText(text, &info)
+			}
+		case endsWith(path, "host-names"):
 			if name, ok := findString(update.Value, "host-name"); ok {
 				info.Hostname = name
 			}
-		case strings.HasSuffix(path, "/interface-configurations"):
-			loopback, mgmt := extractInterfaces(update.Value)
+		case endsWith(path, "interface-configurations"):
+			loopback, loopback6, mgmt := extractInterfaces(update.Value)
 			if loopback != "" {
 				info.RouterID = loopback
 			}
+			if loopback6 != "" {
+				info.IPv6RouterID = loopback6
+			}
 			if mgmt != "" {
 				info.MgmtIP = mgmt
 			}
-		case strings.HasSuffix(path, "/isis"):
+		case endsWith(path, "isis"):
 			info.HasISIS = true
-		case strings.HasSuffix(path, "/bgp"):
+			if net, ok := findString(update.Value, "net-name"); ok && info.ISISNet == "" {
+				info.ISISNet = net
+			}
+		case endsWith(path, "segment-routing") || endsWith(path, "srv6"):
+			info.SRv6Locators = append(info.SRv6Locators, findLocators(update.Value)...)
+		case endsWith(path, "bgp"):
 			info.HasBGP = true
 			if info.BGPASN == 0 {
 				if asn, ok := findASN(update.Value); ok {
@@ -46,24 +65,30 @@ func ExtractMatchInfo(updates []gnmi.ConfigUpdate) (MatchInfo, error) {
 		}
 	}
 
-	if info.RouterID == "" && info.Hostname == "" {
-		return info, fmt.Errorf("missing router_id and hostname in config payload")
+	if len(info.Candidates(MatchKeys)) == 0 {
+		return info, fmt.Errorf("missing router_id, ipv6 router_id, srv6 locator, isis net and hostname in config payload")
 	}
 
 	return info, nil
 }
 
-func extractInterfaces(value interface{}) (string, string) {
+// endsWith reports whether the path's last element is name, with or without
+// a module prefix.
+func endsWith(path, name string) bool {
+	return strings.HasSuffix(path, "/"+name) || strings.HasSuffix(path, ":"+name)
+}
+
+func extractInterfaces(value interface{}) (string, string, string) {
 	root, ok := value.(map[string]interface{})
 	if !ok {
-		return "", ""
+		return "", "", ""
 	}
 	rawList, ok := root["interface-configuration"].([]interface{})
 	if !ok {
-		return "", ""
+		return "", "", ""
 	}
 
-	var loopback string
+	var loopback, loopback6 string
 	var mgmt string
 	for _, item := range rawList {
 		entry, ok := item.(map[string]interface{})
@@ -75,11 +100,14 @@ func extractInterfaces(value interface{}) (string, string) {
 		if ifName == "Loopback0" && ipv4 != "" {
 			loopback = ipv4
 		}
+		if ipv6 := extractIPv6(entry); ifName == "Loopback0" && ipv6 != "" {
+			loopback6 = ipv6
+		}
 		if strings.HasPrefix(ifName, "MgmtEth") && ipv4 != "" {
 			mgmt = ipv4
 		}
 	}
-	return loopback, mgmt
+	return loopback, loopback6, mgmt
 }
 
 func extractPrimaryIPv4(entry map[string]interface{}) string {
@@ -99,6 +127,99 @@ func extractPrimaryIPv4(entry map[string]interface{}) string {
 	return address
 }
 
+func extractIPv6(entry map[string]interface{}) string {
+	ipv6, ok := entry["Cisco-IOS-XR-ipv6-ma-cfg:ipv6-network"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	addresses, ok := ipv6["addresses"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	regular, ok := addresses["regular-addresses"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	list, ok := regular["regular-address"].([]interface{})
+	if !ok || len(list) == 0 {
+		return ""
+	}
+	first, ok := list[0].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	address, _ := first["address"].(string)
+	return address
+}
+
+// findLocators collects SRv6 locator prefixes: entries of a "locator" list
+// with a "prefix" given as "addr/len" or as {"prefix", "prefix-length"}.
+func findLocators(value interface{}) []string {
+	var out []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if key == "locator" || strings.HasSuffix(key, ":locator") {
+				out = append(out, locatorPrefixes(item)...)
+				continue
+			}
+			out = append(out, findLocators(item)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, findLocators(item)...)
+		}
+	}
+	return out
+}
+
+func locatorPrefixes(value interface{}) []string {
+	entries, ok := value.([]interface{})
+	if !ok {
+		entries = []interface{}{value}
+	}
+	var out []string
+	for _, item := range entries {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch prefix := entry["prefix"].(type) {
+		case string:
+			out = append(out, prefix)
+		case map[string]interface{}:
+			addr, _ := prefix["prefix"].(string)
+			length, ok := toInt(prefix["prefix-length"])
+			if addr != "" && ok {
+				out = append(out, fmt.Sprintf("%s/%d", addr, length))
+			}
+		}
+	}
+	return out
+}
+
+// systemID returns the IS-IS system ID of a NET such as
+// "49.0001.0000.0000.0001.00": the three groups before the selector.
+func systemID(net string) string {
+	groups := strings.Split(net, ".")
+	if len(groups) < 5 {
+		return ""
+	}
+	return strings.Join(groups[len(groups)-4:len(groups)-1], ".")
+}
+
+// canonicalAddr formats an address, or the address of a prefix, the way
+// Go and GoBMP print it, so keys compare equal to the stored fields.
+func canonicalAddr(raw string) string {
+	if prefix, err := netip.ParsePrefix(raw); err == nil {
+		return prefix.Addr().String()
+	}
+	if addr, err := netip.ParseAddr(raw); err == nil {
+		return addr.String()
+	}
+	return raw
+}
+
 func findString(value interface{}, key string) (string, bool) {
 	switch v := value.(type) {
 	case map[string]interface{}:
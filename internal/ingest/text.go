@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Block is one line of a text config with the lines indented under it.
+type Block struct {
+	Line     string
+	Children []*Block
+}
+
+// Find returns the children whose line starts with the given words.
+func (b *Block) Find(prefix string) []*Block {
+	var out []*Block
+	for _, block := range b.Children {
+		if hasWords(block.Line, prefix) {
+			out = append(out, block)
+		}
+	}
+	return out
+}
+
+// hasWords reports whether line starts with the words of prefix.
+func hasWords(line, prefix string) bool {
+	return line == prefix || strings.HasPrefix(line, prefix+" ")
+}
+
+// ParseText builds the block tree of an FRR or IOS-style config, where
+// indentation nests a line under the one above. Comments ("!"), blank lines
+// and the "exit" lines FRR closes blocks with are dropped.
+func ParseText(text string) []*Block {
+	type level struct {
+		indent int
+		block  *Block
+	}
+	root := &Block{}
+	stack := []level{{indent: -1, block: root}}
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		line := strings.TrimLeft(raw, " \t")
+		if line == "" || strings.HasPrefix(line, "!") || line == "end" || hasWords(line, "exit") || strings.HasPrefix(line, "exit-") {
+			continue
+		}
+		indent := len(raw) - len(line)
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		block := &Block{Line: line}
+		parent := stack[len(stack)-1].block
+		parent.Children = append(parent.Children, block)
+		stack = append(stack, level{indent: indent, block: block})
+	}
+	return root.Children
+}
+
+// extractText fills in what a text config says about the router. The BGP
+// router-id is preferred as router ID, then a global router-id, then the
+// first loopback address.
+func extractText(text string, info *MatchInfo) {
+	root := &Block{Children: ParseText(text)}
+
+	var bgpRouterID, globalRouterID string
+	for _, block := range root.Children {
+		fields := strings.Fields(block.Line)
+		switch {
+		case fields[0] == "hostname" && len(fields) > 1:
+			if info.Hostname == "" {
+				info.Hostname = fields[1]
+			}
+		case hasWords(block.Line, "router-id") || hasWords(block.Line, "ip router-id"):
+			globalRouterID = fields[len(fields)-1]
+		case fields[0] == "interface" && len(fields) > 1:
+			name := fields[1]
+			if addr6 := interfaceAddress(block, "ipv6"); isLoopback(name) && addr6 != "" && info.IPv6RouterID == "" {
+				info.IPv6RouterID = addr6
+			}
+			addr := interfaceIPv4(block)
+			if addr == "" {
+				continue
+			}
+			if isLoopback(name) {
+				info.Loopbacks = append(info.Loopbacks, addr)
+			}
+			if strings.HasPrefix(name, "MgmtEth") && info.MgmtIP == "" {
+				info.MgmtIP = addr
+			}
+		case hasWords(block.Line, "router bgp"):
+			info.HasBGP = true
+			// Only the default instance identifies the router.
+			if len(fields) != 3 {
+				continue
+			}
+			if asn, err := strconv.Atoi(fields[2]); err == nil && info.BGPASN == 0 {
+				info.BGPASN = asn
+			}
+			for _, id := range block.Find("bgp router-id") {
+				bgpRouterID = strings.TrimPrefix(id.Line, "bgp router-id ")
+			}
+		case hasWords(block.Line, "router isis"):
+			info.HasISIS = true
+			for _, net := range block.Find("net") {
+				if info.ISISNet == "" {
+					info.ISISNet = strings.TrimPrefix(net.Line, "net ")
+				}
+			}
+		case block.Line == "segment-routing":
+			info.SRv6Locators = append(info.SRv6Locators, textLocators(block)...)
+		case hasWords(block.Line, "router ospf") || hasWords(block.Line, "router ospfv3"):
+			info.HasOSPF = true
+		}
+	}
+
+	if info.RouterID != "" {
+		return
+	}
+	switch {
+	case bgpRouterID != "":
+		info.RouterID = bgpRouterID
+	case globalRouterID != "":
+		info.RouterID = globalRouterID
+	case len(info.Loopbacks) > 0:
+		info.RouterID = info.Loopbacks[0]
+	}
+}
+
+func isLoopback(name string) bool {
+	name = strings.ToLower(name)
+	return name == "lo" || strings.HasPrefix(name, "loopback")
+}
+
+// interfaceIPv4 returns the interface's first IPv4 address without its
+// prefix length or mask, from "ip address" (FRR, IOS) or "ipv4 address" (XR).
+func interfaceIPv4(block *Block) string {
+	if addr := interfaceAddress(block, "ip"); addr != "" {
+		return addr
+	}
+	return interfaceAddress(block, "ipv4")
+}
+
+// interfaceAddress returns the first "<family> address" of the interface
+// without its prefix length or mask.
+func interfaceAddress(block *Block, family string) string {
+	for _, child := range block.Children {
+		fields := strings.Fields(child.Line)
+		if len(fields) < 3 || fields[0] != family || fields[1] != "address" {
+			continue
+		}
+		addr, _, _ := strings.Cut(fields[2], "/")
+		return addr
+	}
+	return ""
+}
+
+// textLocators lists the prefixes of "srv6 / locators / locator <name> /
+// prefix <prefix>" under segment-routing, as both XR and FRR write them.
+func textLocators(block *Block) []string {
+	var out []string
+	for _, srv6 := range block.Find("srv6") {
+		for _, locators := range srv6.Find("locators") {
+			for _, locator := range locators.Find("locator") {
+				for _, prefix := range locator.Find("prefix") {
+					out = append(out, strings.TrimPrefix(prefix.Line, "prefix "))
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/ingest"
+)
+
+// ArangoProvider turns Jalapeno topology nodes into hosts.
+type ArangoProvider struct {
+	cfg config.ArangoInventoryConfig
+
+	mu sync.Mutex
+	db driver.Database
+}
+
+type arangoNode struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func NewArangoProvider(cfg config.ArangoInventoryConfig) *ArangoProvider {
+	return &ArangoProvider{cfg: cfg}
+}
+
+func (p *ArangoProvider) Name() string {
+	return "arango"
+}
+
+func (p *ArangoProvider) Hosts(ctx context.Context) ([]config.Host, error) {
+	db, err := p.database()
+	if err != nil {
+		return nil, err
+	}
+
+	addrPath := strings.Split(p.cfg.AddressFrom, ".")
+	filter := "true"
+	if p.cfg.Filter != "" {
+		filter = p.cfg.Filter
+	}
+	// Only the name and the top-level address attribute are returned; node
+	// documents also carry running_config and can be large.
+	query := fmt.Sprintf(`
+FOR n IN @@collection
+	FILTER %s
+	RETURN { name: n[@name], value: n[@address] }
+`, filter)
+
+	hosts := []config.Host{}
+	seen := map[string]bool{}
+	for _, collection := range p.cfg.Collections {
+		cursor, err := db.Query(ctx, query, map[string]interface{}{
+			"@collection": collection,
+			"name":        p.cfg.NameFrom,
+			"address":     addrPath[0],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", collection, err)
+		}
+
+		for {
+			var node arangoNode
+			_, err := cursor.ReadDocument(ctx, &node)
+			if driver.IsNoMoreDocuments(err) {
+				break
+			}
+			if err != nil {
+				cursor.Close()
+				return nil, fmt.Errorf("read %s: %w", collection, err)
+			}
+			addr, ok := lookupString(node.Value, addrPath[1:])
+			if node.Name == "" || !ok || addr == "" || seen[node.Name] {
+				continue
+			}
+			seen[node.Name] = true
+			hosts = append(hosts, withDefaults(config.Host{Name: node.Name, Address: addr}, p.cfg.Defaults, p.cfg.Port))
+		}
+		cursor.Close()
+	}
+	return hosts, nil
+}
+
+func (p *ArangoProvider) database() (driver.Database, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.db != nil {
+		return p.db, nil
+	}
+	db, err := ingest.OpenDatabase(ingest.ArangoConfigFrom(p.cfg.ArangoConfig))
+	if err != nil {
+		return nil, err
+	}
+	p.db = db
+	return db, nil
+}
+
+func lookupString(value interface{}, path []string) (string, bool) {
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		value = m[key]
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
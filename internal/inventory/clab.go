@@ -0,0 +1,215 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ClabProfile holds the gNMI defaults for one containerlab node kind.
+type ClabProfile struct {
+	Port     int
+	Insecure bool
+	Username string
+	Password string
+	Paths    []string
+}
+
+// ClabProfiles are the built-in per-kind defaults used by ImportClab.
+var ClabProfiles = map[string]ClabProfile{
+	"cisco_xrd": {
+		Port:     57400,
+		Insecure: true,
+		Username: "clab",
+		Password: "clab@123",
+		Paths: []string{
+			"/Cisco-IOS-XR-shellutil-cfg:host-names",
+			"/Cisco-IOS-XR-ifmgr-cfg:interface-configurations",
+			"/Cisco-IOS-XR-clns-isis-cfg:isis",
+			"/Cisco-IOS-XR-ipv4-bgp-cfg:bgp",
+			"/Cisco-IOS-XR-segment-routing-ms-cfg:sr",
+		},
+	},
+	"cisco_xrv9k": {
+		Port:     57400,
+		Insecure: true,
+		Username: "clab",
+		Password: "clab@123",
+		Paths:    []string{"/"},
+	},
+	"nokia_srlinux": {
+		Port:     57400,
+		Username: "admin",
+		Password: "NokiaSrl1!",
+		Paths:    []string{"/"},
+	},
+	"arista_ceos": {
+		Port:     6030,
+		Insecure: true,
+		Username: "admin",
+		Password: "admin",
+		Paths:    []string{"/"},
+	},
+}
+
+type ClabOptions struct {
+	TopologyFile  string
+	InventoryFile string
+	Kinds         []string
+	Port          int
+	Username      string
+	Password      string
+}
+
+type clabTopology struct {
+	Name     string  `yaml:"name"`
+	Prefix   *string `yaml:"prefix"`
+	Topology struct {
+		Defaults clabNode            `yaml:"defaults"`
+		Nodes    map[string]clabNode `yaml:"nodes"`
+	} `yaml:"topology"`
+}
+
+type clabNode struct {
+	Kind     string `yaml:"kind"`
+	MgmtIPv4 string `yaml:"mgmt-ipv4"`
+	MgmtIPv6 string `yaml:"mgmt-ipv6"`
+}
+
+// clabInventory is the ansible-inventory.yml containerlab writes to the lab
+// directory; it has the management addresses of nodes without static ones.
+type clabInventory struct {
+	All struct {
+		Children map[string]struct {
+			Hosts map[string]struct {
+				AnsibleHost string `yaml:"ansible_host"`
+			} `yaml:"hosts"`
+		} `yaml:"children"`
+	} `yaml:"all"`
+}
+
+// ImportClab builds hosts from a containerlab topology, keeping nodes whose
+// kind is in opts.Kinds (all kinds with a profile when empty). Nodes whose
+// address cannot be determined are reported in the returned skip list.
+func ImportClab(opts ClabOptions) ([]config.Host, []string, error) {
+	raw, err := os.ReadFile(opts.TopologyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var topo clabTopology
+	if err := yaml.Unmarshal(raw, &topo); err != nil {
+		return nil, nil, fmt.Errorf("parse topology: %w", err)
+	}
+
+	addrs := map[string]string{}
+	if opts.InventoryFile != "" {
+		addrs, err = readClabInventory(opts.InventoryFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	kinds := map[string]bool{}
+	for _, kind := range opts.Kinds {
+		kinds[kind] = true
+	}
+
+	names := make([]string, 0, len(topo.Topology.Nodes))
+	for name := range topo.Topology.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hosts := []config.Host{}
+	skipped := []string{}
+	for _, name := range names {
+		node := topo.Topology.Nodes[name]
+		kind := node.Kind
+		if kind == "" {
+			kind = topo.Topology.Defaults.Kind
+		}
+		profile, known := ClabProfiles[kind]
+		if (len(kinds) > 0 && !kinds[kind]) || (len(kinds) == 0 && !known) {
+			continue
+		}
+
+		// Management addresses are per node; one set under kinds or
+		// defaults would give every node of the kind the same address.
+		addr := node.MgmtIPv4
+		if addr == "" {
+			addr = addrs[topo.containerName(name)]
+		}
+		if addr == "" {
+			addr = node.MgmtIPv6
+		}
+		if addr == "" {
+			skipped = append(skipped, name)
+			continue
+		}
+
+		port := profile.Port
+		if opts.Port != 0 {
+			port = opts.Port
+		}
+		if port == 0 {
+			port = 57400
+		}
+		host := config.Host{
+			Name:    name,
+			Address: withPort(addr, port),
+			Target:  name,
+			HostSettings: config.HostSettings{
+				Username: profile.Username,
+				Password: profile.Password,
+				Paths:    profile.Paths,
+			},
+		}
+		if known {
+			insecure := profile.Insecure
+			host.Insecure = &insecure
+		}
+		if opts.Username != "" {
+			host.Username = opts.Username
+		}
+		if opts.Password != "" {
+			host.Password = opts.Password
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, skipped, nil
+}
+
+// containerName follows containerlab's naming: clab-<lab>-<node> by default,
+// <prefix>-<lab>-<node> with a custom prefix and just <node> with an empty one.
+func (t clabTopology) containerName(node string) string {
+	if t.Prefix == nil {
+		return "clab-" + t.Name + "-" + node
+	}
+	if *t.Prefix == "" {
+		return node
+	}
+	return *t.Prefix + "-" + t.Name + "-" + node
+}
+
+func readClabInventory(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inv clabInventory
+	if err := yaml.Unmarshal(raw, &inv); err != nil {
+		return nil, fmt.Errorf("parse clab inventory: %w", err)
+	}
+	addrs := map[string]string{}
+	for _, group := range inv.All.Children {
+		for name, host := range group.Hosts {
+			if host.AnsibleHost != "" {
+				addrs[name] = host.AnsibleHost
+			}
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,194 @@
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FileProvider reads host files from a directory on every refresh. YAML
+// files hold either a list of hosts or a "hosts:" key; CSV files need a
+// header row naming the columns.
+type FileProvider struct {
+	cfg config.FileInventoryConfig
+}
+
+func NewFileProvider(cfg config.FileInventoryConfig) *FileProvider {
+	return &FileProvider{cfg: cfg}
+}
+
+func (p *FileProvider) Name() string {
+	return "files"
+}
+
+func (p *FileProvider) Hosts(ctx context.Context) ([]config.Host, error) {
+	entries, err := os.ReadDir(p.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	hosts := []config.Host{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		path := filepath.Join(p.cfg.Dir, name)
+		var (
+			parsed []config.Host
+			err    error
+		)
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".yaml", ".yml":
+			parsed, err = readYAMLHosts(path)
+		case ".csv":
+			parsed, err = readCSVHosts(path)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i, h := range parsed {
+			if h.Address == "" {
+				log.Printf("inventory %s: %s: host %d (%q) has no address, skipped", p.Name(), path, i+1, h.Name)
+				continue
+			}
+			h = withDefaults(h, p.cfg.Defaults, p.cfg.Port)
+			if seen[h.Name] {
+				log.Printf("inventory %s: %s: duplicate host %q skipped", p.Name(), path, h.Name)
+				continue
+			}
+			seen[h.Name] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, nil
+}
+
+func readYAMLHosts(path string) ([]config.Host, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHosts(raw)
+}
+
+// decodeHosts accepts a bare list of hosts or a document with a "hosts" key.
+// JSON is valid YAML, so this also serves the HTTP provider.
+func decodeHosts(raw []byte) ([]config.Host, error) {
+	var list []config.Host
+	if err := yaml.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var doc struct {
+		Hosts []config.Host `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Hosts, nil
+}
+
+// readCSVHosts maps columns by header name. List columns (groups, tags,
+// paths) separate values with ";".
+func readCSVHosts(path string) ([]config.Host, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	hosts := make([]config.Host, 0, len(records)-1)
+	for line, record := range records[1:] {
+		var h config.Host
+		for i, column := range header {
+			if i >= len(record) || record[i] == "" {
+				continue
+			}
+			if err := setCSVField(&h, strings.ToLower(strings.TrimSpace(column)), strings.TrimSpace(record[i])); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+2, err)
+			}
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func setCSVField(h *config.Host, column, value string) error {
+	switch column {
+	case "name":
+		h.Name = value
+	case "address":
+		h.Address = value
+	case "target":
+		h.Target = value
+	case "groups":
+		h.Groups = splitList(value)
+	case "tags":
+		h.Tags = splitList(value)
+	case "protocol":
+		h.Protocol = value
+	case "username":
+		h.Username = value
+	case "password":
+		h.Password = value
+	case "insecure":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("insecure: %w", err)
+		}
+		h.Insecure = &b
+	case "paths":
+		h.Paths = splitList(value)
+	case "type":
+		h.Type = value
+	case "strategy":
+		h.Strategy = value
+	case "interval":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("interval: %w", err)
+		}
+		h.Interval = d
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	out := []string{}
+	for _, part := range strings.Split(value, ";") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+// maxInventoryBody caps the size of an HTTP inventory response.
+const maxInventoryBody = 32 << 20
+
+// HTTPProvider fetches hosts from a JSON endpoint such as a NetBox-style
+// device export.
+type HTTPProvider struct {
+	cfg    config.HTTPInventoryConfig
+	client *http.Client
+}
+
+func NewHTTPProvider(cfg config.HTTPInventoryConfig) *HTTPProvider {
+	return &HTTPProvider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (p *HTTPProvider) Name() string {
+	return "http"
+}
+
+func (p *HTTPProvider) Hosts(ctx context.Context) ([]config.Host, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range p.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("GET %s: %s", p.cfg.URL, resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxInventoryBody))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := p.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]config.Host, 0, len(parsed))
+	for _, h := range parsed {
+		if h.Address == "" {
+			continue
+		}
+		hosts = append(hosts, withDefaults(h, p.cfg.Defaults, p.cfg.Port))
+	}
+	return hosts, nil
+}
+
+func (p *HTTPProvider) parse(raw []byte) ([]config.Host, error) {
+	if p.cfg.Items == "" && len(p.cfg.Fields) == 0 {
+		return decodeHosts(raw)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	items := doc
+	if p.cfg.Items != "" {
+		items = lookup(doc, p.cfg.Items)
+	}
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("items %q is not a list", p.cfg.Items)
+	}
+
+	if len(p.cfg.Fields) == 0 {
+		blob, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		return decodeHosts(blob)
+	}
+
+	hosts := make([]config.Host, 0, len(list))
+	for _, item := range list {
+		var h config.Host
+		for field, path := range p.cfg.Fields {
+			values := extractStrings(item, path)
+			if len(values) == 0 {
+				continue
+			}
+			switch field {
+			case "name":
+				h.Name = values[0]
+			case "address":
+				h.Address = values[0]
+			case "target":
+				h.Target = values[0]
+			case "groups":
+				h.Groups = values
+			case "tags":
+				h.Tags = values
+			default:
+				return nil, fmt.Errorf("unsupported field mapping %q", field)
+			}
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func lookup(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// extractStrings resolves a dotted path, mapping over lists marked with "[]".
+func extractStrings(value interface{}, path string) []string {
+	if path == "" {
+		switch v := value.(type) {
+		case string:
+			return []string{v}
+		case []interface{}:
+			out := []string{}
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					out = append(out, s)
+				}
+			}
+			return out
+		}
+		return nil
+	}
+
+	segment, rest, _ := strings.Cut(path, ".")
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	key, each := strings.CutSuffix(segment, "[]")
+	if !each {
+		return extractStrings(m[key], rest)
+	}
+	list, ok := m[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	out := []string{}
+	for _, item := range list {
+		out = append(out, extractStrings(item, rest)...)
+	}
+	return out
+}
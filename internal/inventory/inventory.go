@@ -0,0 +1,256 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+// Provider returns the hosts known to one inventory source.
+type Provider interface {
+	Name() string
+	Hosts(ctx context.Context) ([]config.Host, error)
+}
+
+// Inventory merges the static host list with dynamic providers. Static hosts
+// win over discovered ones with the same name; between providers the first
+// configured wins. A provider that fails keeps its last good host list.
+type Inventory struct {
+	static    []config.Host
+	providers []Provider
+	refresh   time.Duration
+
+	mu     sync.RWMutex
+	cached map[string][]config.Host
+	hosts  []config.Host
+	// version counts refreshes that changed the merged host list.
+	version uint64
+}
+
+func New(cfg *config.Config) (*Inventory, error) {
+	inv := &Inventory{
+		static:  cfg.Hosts,
+		refresh: cfg.Inventory.Refresh,
+		cached:  map[string][]config.Host{},
+		hosts:   cfg.Hosts,
+	}
+	if cfg.Inventory.Arango != nil {
+		inv.providers = append(inv.providers, NewArangoProvider(*cfg.Inventory.Arango))
+	}
+	if cfg.Inventory.Files != nil {
+		if cfg.Inventory.Files.Dir == "" {
+			return nil, fmt.Errorf("inventory files: dir is required")
+		}
+		inv.providers = append(inv.providers, NewFileProvider(*cfg.Inventory.Files))
+	}
+	if cfg.Inventory.HTTP != nil {
+		if cfg.Inventory.HTTP.URL == "" {
+			return nil, fmt.Errorf("inventory http: url is required")
+		}
+		inv.providers = append(inv.providers, NewHTTPProvider(*cfg.Inventory.HTTP))
+	}
+	return inv, nil
+}
+
+func (i *Inventory) Hosts() []config.Host {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.hosts
+}
+
+// Refresh queries every provider and rebuilds the merged host list.
+func (i *Inventory) Refresh(ctx context.Context) {
+	if len(i.providers) == 0 {
+		return
+	}
+
+	for _, p := range i.providers {
+		hosts, err := p.Hosts(ctx)
+		if err != nil {
+			log.Printf("inventory %s refresh failed: %v", p.Name(), err)
+			continue
+		}
+		i.mu.Lock()
+		i.cached[p.Name()] = hosts
+		i.mu.Unlock()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	merged := make([]config.Host, 0, len(i.static))
+	seen := map[string]bool{}
+	add := func(hosts []config.Host) {
+		for _, h := range hosts {
+			if seen[h.Name] {
+				continue
+			}
+			seen[h.Name] = true
+			merged = append(merged, h)
+		}
+	}
+	add(i.static)
+	for _, p := range i.providers {
+		add(i.cached[p.Name()])
+	}
+
+	if !slices.EqualFunc(i.hosts, merged, func(a, b config.Host) bool { return reflect.DeepEqual(a, b) }) {
+		i.version++
+	}
+	logChanges(i.hosts, merged)
+	i.hosts = merged
+}
+
+// Version changes whenever Refresh changes the host list, so callers can
+// keep what they derive from Hosts until it does.
+func (i *Inventory) Version() uint64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.version
+}
+
+// Run refreshes the inventory until ctx is done.
+func (i *Inventory) Run(ctx context.Context) {
+	if len(i.providers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(i.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.Refresh(ctx)
+		}
+	}
+}
+
+// withDefaults fills the fields a discovered host leaves empty from the
+// provider's defaults. port is left for Resolve to append to a bare address,
+// as only gNMI hosts take it.
+func withDefaults(h, d config.Host, port int) config.Host {
+	if h.Name == "" {
+		h.Name = h.Address
+	}
+	h.Address = stripPrefix(h.Address)
+	h.DefaultPort = port
+	if h.Target == "" {
+		h.Target = d.Target
+	}
+	if h.Target == "" {
+		h.Target = h.Name
+	}
+	if len(h.Groups) == 0 {
+		h.Groups = d.Groups
+	}
+	if len(h.Tags) == 0 {
+		h.Tags = d.Tags
+	}
+	s, ds := &h.HostSettings, d.HostSettings
+	if s.Protocol == "" {
+		s.Protocol = ds.Protocol
+	}
+	if s.SSH == nil {
+		s.SSH = ds.SSH
+	}
+	if s.Netconf == nil {
+		s.Netconf = ds.Netconf
+	}
+	if s.Username == "" {
+		s.Username = ds.Username
+	}
+	if s.Password == "" {
+		s.Password = ds.Password
+	}
+	if s.Credentials == nil {
+		s.Credentials = ds.Credentials
+	}
+	if s.Auth == nil {
+		s.Auth = ds.Auth
+	}
+	if s.Insecure == nil {
+		s.Insecure = ds.Insecure
+	}
+	if len(s.Paths) == 0 {
+		s.Paths = ds.Paths
+	}
+	if s.Type == "" {
+		s.Type = ds.Type
+	}
+	if s.Strategy == "" {
+		s.Strategy = ds.Strategy
+	}
+	if s.TLS == nil {
+		s.TLS = ds.TLS
+	}
+	// Interval and schedule are one setting: a host that sets either keeps
+	// its own cadence.
+	if s.Interval == 0 && s.Schedule == "" {
+		s.Interval = ds.Interval
+		s.Schedule = ds.Schedule
+	}
+	if s.Jitter == 0 {
+		s.Jitter = ds.Jitter
+	}
+	if len(s.Blackouts) == 0 {
+		s.Blackouts = ds.Blackouts
+	}
+	return h
+}
+
+// stripPrefix drops the prefix length of an address without a port, such as
+// a mgmt-IP stored as "10.0.0.1/24".
+func stripPrefix(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	if idx := strings.Index(addr, "/"); idx >= 0 {
+		addr = addr[:idx]
+	}
+	return addr
+}
+
+// withPort appends port unless addr already has one, after stripPrefix.
+func withPort(addr string, port int) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(stripPrefix(addr), strconv.Itoa(port))
+}
+
+func logChanges(before, after []config.Host) {
+	old := map[string]bool{}
+	for _, h := range before {
+		old[h.Name] = true
+	}
+	added := []string{}
+	for _, h := range after {
+		if !old[h.Name] {
+			added = append(added, h.Name)
+		}
+		delete(old, h.Name)
+	}
+	removed := make([]string, 0, len(old))
+	for name := range old {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+
+	if len(added) > 0 {
+		log.Printf("inventory added %d hosts: %v", len(added), added)
+	}
+	if len(removed) > 0 {
+		log.Printf("inventory removed %d hosts: %v", len(removed), removed)
+	}
+}
@@ -0,0 +1,211 @@
+package kafka
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Chunked messages carry a slice of one oversized payload. Every chunk of a
+// payload shares the same key (and therefore partition), ID, count and
+// checksum; the checksum covers the reassembled, still-encoded payload.
+const (
+	HeaderChunkID       = "config-pub-chunk-id"
+	HeaderChunkIndex    = "config-pub-chunk-index"
+	HeaderChunkCount    = "config-pub-chunk-count"
+	HeaderChunkChecksum = "config-pub-chunk-checksum"
+
+	// chunkHeadroom is reserved in each chunk for the key and headers.
+	chunkHeadroom = 1024
+
+	// MaxChunkedPayload bounds a payload split into chunks, and so what a
+	// chunk set may buffer while it is reassembled.
+	MaxChunkedPayload = 256 << 20
+	// minChunkSize is the smallest chunk split into; with MaxChunkedPayload
+	// it bounds the chunk count a set may claim.
+	minChunkSize = 64 << 10
+	MaxChunks    = MaxChunkedPayload / minChunkSize
+)
+
+// SplitChunks splits payload into messages of at most maxMsg bytes, each
+// carrying the chunk headers followed by headers.
+func SplitChunks(key []byte, payload []byte, maxMsg int, headers []kafka.Header, now time.Time) ([]kafka.Message, error) {
+	size := maxMsg - chunkHeadroom
+	if size < minChunkSize {
+		return nil, fmt.Errorf("max message size %d too small for chunking (want at least %d)", maxMsg, minChunkSize+chunkHeadroom)
+	}
+	if len(payload) > MaxChunkedPayload {
+		return nil, fmt.Errorf("payload of %d bytes exceeds the %d byte chunking limit", len(payload), MaxChunkedPayload)
+	}
+
+	id, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+	sum := checksum(payload)
+	count := (len(payload) + size - 1) / size
+
+	msgs := make([]kafka.Message, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunkHeaders := append([]kafka.Header{
+			{Key: HeaderChunkID, Value: []byte(id)},
+			{Key: HeaderChunkIndex, Value: []byte(strconv.Itoa(i))},
+			{Key: HeaderChunkCount, Value: []byte(strconv.Itoa(count))},
+			{Key: HeaderChunkChecksum, Value: []byte(sum)},
+		}, headers...)
+		msgs = append(msgs, kafka.Message{
+			Key:     key,
+			Value:   payload[i*size : end],
+			Headers: chunkHeaders,
+			Time:    now,
+		})
+	}
+	return msgs, nil
+}
+
+func newMessageID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("message id: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// ChunkError reports a chunk, or a whole chunk set, that Add or Expire
+// dropped. Messages holds the chunks as they were received so they can be
+// dead-lettered.
+type ChunkError struct {
+	ID       string
+	Messages []kafka.Message
+	Err      error
+}
+
+func (e *ChunkError) Error() string { return fmt.Sprintf("chunk %s: %v", e.ID, e.Err) }
+
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// Reassembler collects chunked messages until a payload is complete.
+// Incomplete sets older than the timeout are dropped by Expire.
+type Reassembler struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	sets    map[string]*chunkSet
+}
+
+type chunkSet struct {
+	parts    []*kafka.Message
+	received int
+	size     int
+	checksum string
+	headers  []kafka.Header
+	started  time.Time
+}
+
+// drop returns the error for a set dropped before it completed, carrying
+// the chunks it had received followed by extra.
+func (s *chunkSet) drop(id string, err error, extra ...kafka.Message) *ChunkError {
+	msgs := make([]kafka.Message, 0, s.received+len(extra))
+	for _, part := range s.parts {
+		if part != nil {
+			msgs = append(msgs, *part)
+		}
+	}
+	return &ChunkError{ID: id, Messages: append(msgs, extra...), Err: err}
+}
+
+func NewReassembler(timeout time.Duration) *Reassembler {
+	return &Reassembler{timeout: timeout, sets: map[string]*chunkSet{}}
+}
+
+// Add returns the payload and headers once every chunk of its set has
+// arrived. Messages without chunk headers are returned as they are. Errors
+// are *ChunkError; a chunk that conflicts with its set drops the whole set.
+func (r *Reassembler) Add(msg kafka.Message) ([]byte, []kafka.Header, bool, error) {
+	id := Header(msg.Headers, HeaderChunkID)
+	if id == "" {
+		return msg.Value, msg.Headers, true, nil
+	}
+	reject := func(err error) ([]byte, []kafka.Header, bool, error) {
+		return nil, nil, false, &ChunkError{ID: id, Messages: []kafka.Message{msg}, Err: err}
+	}
+
+	index, err := strconv.Atoi(Header(msg.Headers, HeaderChunkIndex))
+	if err != nil {
+		return reject(fmt.Errorf("invalid index: %w", err))
+	}
+	count, err := strconv.Atoi(Header(msg.Headers, HeaderChunkCount))
+	if err != nil || count <= 0 || count > MaxChunks {
+		return reject(fmt.Errorf("invalid count %q (want 1-%d)", Header(msg.Headers, HeaderChunkCount), MaxChunks))
+	}
+	if index < 0 || index >= count {
+		return reject(fmt.Errorf("index %d out of range (count %d)", index, count))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, ok := r.sets[id]
+	if !ok {
+		set = &chunkSet{
+			parts:    make([]*kafka.Message, count),
+			checksum: Header(msg.Headers, HeaderChunkChecksum),
+			headers:  msg.Headers,
+			started:  time.Now(),
+		}
+		r.sets[id] = set
+	}
+	if len(set.parts) != count {
+		delete(r.sets, id)
+		return nil, nil, false, set.drop(id, fmt.Errorf("count changed from %d to %d", len(set.parts), count), msg)
+	}
+	if set.parts[index] == nil {
+		if set.size+len(msg.Value) > MaxChunkedPayload {
+			delete(r.sets, id)
+			return nil, nil, false, set.drop(id, fmt.Errorf("set exceeds %d bytes", MaxChunkedPayload), msg)
+		}
+		set.parts[index] = &msg
+		set.size += len(msg.Value)
+		set.received++
+	}
+	if set.received < count {
+		return nil, nil, false, nil
+	}
+
+	delete(r.sets, id)
+	values := make([][]byte, count)
+	for i, part := range set.parts {
+		values[i] = part.Value
+	}
+	payload := bytes.Join(values, nil)
+	if set.checksum != "" && checksum(payload) != set.checksum {
+		return nil, nil, false, set.drop(id, errors.New("checksum mismatch"))
+	}
+	return payload, set.headers, true, nil
+}
+
+// Expire drops incomplete sets started before now minus the timeout and
+// returns an error for each, carrying the chunks it had received.
+func (r *Reassembler) Expire(now time.Time) []*ChunkError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired []*ChunkError
+	for id, set := range r.sets {
+		if now.Sub(set.started) > r.timeout {
+			delete(r.sets, id)
+			expired = append(expired, set.drop(id, fmt.Errorf("incomplete after %s (%d of %d chunks)", r.timeout, set.received, len(set.parts))))
+		}
+	}
+	return expired
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const testMaxMsg = minChunkSize + chunkHeadroom
+
+func payloadOf(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func split(t *testing.T, payload []byte) []kafka.Message {
+	t.Helper()
+	msgs, err := SplitChunks([]byte("r1"), payload, testMaxMsg, []kafka.Header{{Key: HeaderContentType, Value: []byte("application/json")}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func setHeader(msg kafka.Message, key, value string) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			h.Value = []byte(value)
+		}
+		headers = append(headers, h)
+	}
+	msg.Headers = headers
+	return msg
+}
+
+func TestSplitChunks(t *testing.T) {
+	payload := payloadOf(3*minChunkSize + 17)
+	msgs := split(t, payload)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d chunks, want 4", len(msgs))
+	}
+	id := Header(msgs[0].Headers, HeaderChunkID)
+	var joined []byte
+	for i, m := range msgs {
+		if len(m.Value) > minChunkSize {
+			t.Errorf("chunk %d is %d bytes, over %d", i, len(m.Value), minChunkSize)
+		}
+		if string(m.Key) != "r1" || Header(m.Headers, HeaderChunkID) != id {
+			t.Errorf("chunk %d key %q id %q, want r1 %q", i, m.Key, Header(m.Headers, HeaderChunkID), id)
+		}
+		if got := Header(m.Headers, HeaderChunkIndex); got != strconv.Itoa(i) {
+			t.Errorf("chunk %d has index %s", i, got)
+		}
+		if Header(m.Headers, HeaderChunkCount) != "4" || Header(m.Headers, HeaderContentType) != "application/json" {
+			t.Errorf("chunk %d headers %v", i, m.Headers)
+		}
+		joined = append(joined, m.Value...)
+	}
+	if !bytes.Equal(joined, payload) {
+		t.Error("chunks do not join to the payload")
+	}
+
+	if _, err := SplitChunks(nil, payload, minChunkSize, nil, time.Now()); err == nil {
+		t.Error("split with a max message size below the minimum chunk succeeded")
+	}
+	if _, err := SplitChunks(nil, make([]byte, MaxChunkedPayload+1), testMaxMsg, nil, time.Now()); err == nil {
+		t.Error("split of a payload over the chunking limit succeeded")
+	}
+}
+
+func TestReassemble(t *testing.T) {
+	payload := payloadOf(2*minChunkSize + 5)
+	msgs := split(t, payload)
+	r := NewReassembler(time.Minute)
+
+	// Out of order, with a duplicate: only the last missing chunk completes.
+	for _, i := range []int{2, 0, 2} {
+		if _, _, complete, err := r.Add(msgs[i]); err != nil || complete {
+			t.Fatalf("chunk %d: complete %v, err %v", i, complete, err)
+		}
+	}
+	value, headers, complete, err := r.Add(msgs[1])
+	if err != nil || !complete {
+		t.Fatalf("last chunk: complete %v, err %v", complete, err)
+	}
+	if !bytes.Equal(value, payload) {
+		t.Error("reassembled payload differs")
+	}
+	if Header(headers, HeaderContentType) != "application/json" {
+		t.Errorf("headers %v, want the chunk headers", headers)
+	}
+	if len(r.sets) != 0 {
+		t.Errorf("%d sets left after completion", len(r.sets))
+	}
+
+	plain := kafka.Message{Key: []byte("r2"), Value: []byte("{}")}
+	if value, _, complete, err := r.Add(plain); err != nil || !complete || string(value) != "{}" {
+		t.Errorf("unchunked message: %q complete %v, err %v", value, complete, err)
+	}
+}
+
+func TestReassembleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// msgs returns the messages to add; the last must fail.
+		msgs func(chunks []kafka.Message) []kafka.Message
+		// dropped is the number of chunks the error carries.
+		dropped int
+		wantErr string
+	}{
+		{
+			name: "bad index",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				return []kafka.Message{setHeader(c[0], HeaderChunkIndex, "x")}
+			},
+			dropped: 1,
+			wantErr: "invalid index",
+		},
+		{
+			name: "index out of range",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				return []kafka.Message{setHeader(c[0], HeaderChunkIndex, "3")}
+			},
+			dropped: 1,
+			wantErr: "index 3 out of range",
+		},
+		{
+			name: "too many chunks",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				return []kafka.Message{setHeader(c[0], HeaderChunkCount, strconv.Itoa(MaxChunks+1))}
+			},
+			dropped: 1,
+			wantErr: "invalid count",
+		},
+		{
+			name: "count changed",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				return []kafka.Message{c[0], setHeader(c[1], HeaderChunkCount, "2")}
+			},
+			dropped: 2,
+			wantErr: "count changed from 3 to 2",
+		},
+		{
+			name: "oversize set",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				big := c[1]
+				big.Value = make([]byte, MaxChunkedPayload)
+				return []kafka.Message{c[0], big}
+			},
+			dropped: 2,
+			wantErr: "exceeds",
+		},
+		{
+			name: "checksum mismatch",
+			msgs: func(c []kafka.Message) []kafka.Message {
+				// The set keeps the checksum of its first chunk.
+				return []kafka.Message{setHeader(c[0], HeaderChunkChecksum, "x"), c[1], c[2]}
+			},
+			dropped: 3,
+			wantErr: "checksum mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(time.Minute)
+			msgs := tt.msgs(split(t, payloadOf(2*minChunkSize+5)))
+			for _, m := range msgs[:len(msgs)-1] {
+				if _, _, _, err := r.Add(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, _, complete, err := r.Add(msgs[len(msgs)-1])
+			var chunkErr *ChunkError
+			if complete || !errors.As(err, &chunkErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("complete %v, err %v, want %q", complete, err, tt.wantErr)
+			}
+			if len(chunkErr.Messages) != tt.dropped {
+				t.Errorf("error carries %d chunks, want %d", len(chunkErr.Messages), tt.dropped)
+			}
+			if tt.dropped > 1 && len(r.sets) != 0 {
+				t.Errorf("%d sets left after the set was dropped", len(r.sets))
+			}
+		})
+	}
+}
+
+func TestReassemblerExpire(t *testing.T) {
+	msgs := split(t, payloadOf(2*minChunkSize+5))
+	r := NewReassembler(time.Minute)
+	for _, m := range msgs[:2] {
+		if _, _, _, err := r.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expired := r.Expire(time.Now()); len(expired) != 0 {
+		t.Fatalf("expired %v before the timeout", expired)
+	}
+	expired := r.Expire(time.Now().Add(2 * time.Minute))
+	if len(expired) != 1 {
+		t.Fatalf("expired %d sets, want 1", len(expired))
+	}
+	if got := expired[0]; got.ID != Header(msgs[0].Headers, HeaderChunkID) || len(got.Messages) != 2 || !strings.Contains(got.Error(), "2 of 3 chunks") {
+		t.Errorf("expired %v with %d chunks", got, len(got.Messages))
+	}
+	if len(r.sets) != 0 {
+		t.Errorf("%d sets left after expiry", len(r.sets))
+	}
+}
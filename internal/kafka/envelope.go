@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/format"
+	"github.com/klauspost/compress/zstd"
+	"github.com/segmentio/kafka-go"
+)
+
+// SchemaVersion is the version of the gnmi.ConfigMessage payload. Bump the
+// minor for additive changes and the major for anything a consumer built
+// against the previous major could misread.
+const (
+	SchemaVersion      = "1.0"
+	SchemaVersionMajor = 1
+)
+
+const (
+	HeaderSchemaVersion      = "config-pub-schema-version"
+	HeaderProducer           = "config-pub-producer"
+	HeaderContentHash        = "config-pub-content-hash"
+	HeaderCollectionDuration = "config-pub-collection-duration"
+	HeaderEncoding           = "content-encoding"
+	HeaderContentType        = "content-type"
+
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+// ProducerVersion is reported in every envelope; override at build time with
+// -ldflags "-X github.com/jalapeno/config-pub/internal/kafka.ProducerVersion=...".
+var ProducerVersion = "dev"
+
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+var errDecodedTooLarge = fmt.Errorf("decoded payload exceeds %d bytes", MaxChunkedPayload)
+
+// Envelope is the metadata published alongside every payload as Kafka
+// headers. ContentHash covers the serialized payload before encoding.
+type Envelope struct {
+	SchemaVersion      string
+	Producer           string
+	ContentType        string
+	ContentEncoding    string
+	ContentHash        string
+	CollectionDuration time.Duration
+}
+
+func (e Envelope) headers() []kafka.Header {
+	headers := []kafka.Header{
+		{Key: HeaderSchemaVersion, Value: []byte(e.SchemaVersion)},
+		{Key: HeaderProducer, Value: []byte(e.Producer)},
+		{Key: HeaderContentType, Value: []byte(e.ContentType)},
+		{Key: HeaderContentHash, Value: []byte(e.ContentHash)},
+	}
+	if e.ContentEncoding != "" && e.ContentEncoding != EncodingIdentity {
+		headers = append(headers, kafka.Header{Key: HeaderEncoding, Value: []byte(e.ContentEncoding)})
+	}
+	if e.CollectionDuration > 0 {
+		headers = append(headers, kafka.Header{Key: HeaderCollectionDuration, Value: []byte(e.CollectionDuration.String())})
+	}
+	return headers
+}
+
+// ParseEnvelope reads the envelope headers. Messages from producers that
+// predate the envelope have no schema version and are treated as 1.0.
+func ParseEnvelope(headers []kafka.Header) (Envelope, error) {
+	env := Envelope{
+		SchemaVersion:   Header(headers, HeaderSchemaVersion),
+		Producer:        Header(headers, HeaderProducer),
+		ContentType:     Header(headers, HeaderContentType),
+		ContentEncoding: Header(headers, HeaderEncoding),
+		ContentHash:     Header(headers, HeaderContentHash),
+	}
+	if env.SchemaVersion == "" {
+		env.SchemaVersion = "1.0"
+	}
+	if env.ContentType == "" {
+		env.ContentType = format.ContentTypeJSON
+	}
+	if env.ContentEncoding == "" {
+		env.ContentEncoding = EncodingIdentity
+	}
+	if raw := Header(headers, HeaderCollectionDuration); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return env, fmt.Errorf("collection duration %q: %w", raw, err)
+		}
+		env.CollectionDuration = d
+	}
+	return env, nil
+}
+
+// CheckVersion accepts any minor of a supported major version.
+func (e Envelope) CheckVersion() error {
+	major, _, _ := strings.Cut(e.SchemaVersion, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, e.SchemaVersion)
+	}
+	if n != SchemaVersionMajor {
+		return fmt.Errorf("%w: %s (supported major %d)", ErrUnsupportedVersion, e.SchemaVersion, SchemaVersionMajor)
+	}
+	return nil
+}
+
+// Decode reverses the content encoding and verifies the content hash.
+func (e Envelope) Decode(payload []byte) ([]byte, error) {
+	decoded, err := decodePayload(e.ContentEncoding, payload)
+	if err != nil {
+		return nil, err
+	}
+	if e.ContentHash != "" && checksum(decoded) != e.ContentHash {
+		return nil, fmt.Errorf("content hash mismatch")
+	}
+	return decoded, nil
+}
+
+func checksum(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func encodePayload(encoding string, payload []byte) ([]byte, error) {
+	switch encoding {
+	case "", EncodingIdentity:
+		return payload, nil
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
+		return zw.EncodeAll(payload, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decodePayload decompresses payload, refusing output larger than
+// MaxChunkedPayload so a small compressed message cannot exhaust memory.
+func decodePayload(encoding string, payload []byte) ([]byte, error) {
+	switch encoding {
+	case "", EncodingIdentity:
+		return payload, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, MaxChunkedPayload+1))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		if len(out) > MaxChunkedPayload {
+			return nil, fmt.Errorf("gzip: %w", errDecodedTooLarge)
+		}
+		return out, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(MaxChunkedPayload),
+			zstd.WithDecoderMaxWindow(MaxChunkedPayload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		out, err := zr.DecodeAll(payload, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			err = errDecodedTooLarge
+		}
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+func parseCompression(value string) (kafka.Compression, error) {
+	switch strings.ToLower(value) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka compression %q", value)
+	}
+}
+
+// Header returns the value of the first header with the given key.
+func Header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/format"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	payload := []byte(`{"target":"r1","updates":[{"path":"/system","value":{"hostname":"r1"}}]}`)
+	for _, encoding := range []string{EncodingIdentity, EncodingGzip, EncodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			env := Envelope{
+				SchemaVersion:      SchemaVersion,
+				Producer:           "config-pub/test",
+				ContentType:        format.ContentTypeJSON,
+				ContentEncoding:    encoding,
+				ContentHash:        checksum(payload),
+				CollectionDuration: 1520 * time.Millisecond,
+			}
+			encoded, err := encodePayload(encoding, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParseEnvelope(env.headers())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, env) {
+				t.Errorf("envelope\n got %+v\nwant %+v", got, env)
+			}
+			if err := got.CheckVersion(); err != nil {
+				t.Error(err)
+			}
+			decoded, err := got.Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, payload) {
+				t.Errorf("decoded %q, want %q", decoded, payload)
+			}
+
+			env.ContentHash = checksum([]byte("other"))
+			if _, err := env.Decode(encoded); err == nil {
+				t.Error("decode with a wrong content hash succeeded")
+			}
+		})
+	}
+}
+
+func TestParseEnvelopeDefaults(t *testing.T) {
+	env, err := ParseEnvelope(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Envelope{SchemaVersion: "1.0", ContentType: format.ContentTypeJSON, ContentEncoding: EncodingIdentity}
+	if env != want {
+		t.Errorf("envelope %+v, want %+v", env, want)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	for version, ok := range map[string]bool{"1.0": true, "1.7": true, "1": true, "2.0": false, "x": false} {
+		err := Envelope{SchemaVersion: version}.CheckVersion()
+		if (err == nil) != ok || (err != nil && !errors.Is(err, ErrUnsupportedVersion)) {
+			t.Errorf("version %s: %v", version, err)
+		}
+	}
+}
+
+// TestDecodeBomb checks that a payload decompressing past MaxChunkedPayload
+// is rejected rather than read into memory.
+func TestDecodeBomb(t *testing.T) {
+	zeros := func(w io.Writer) {
+		if _, err := io.CopyN(w, zeroReader{}, MaxChunkedPayload+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	zeros(gw)
+	gw.Close()
+
+	var zs bytes.Buffer
+	zw, err := zstd.NewWriter(&zs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeros(zw)
+	zw.Close()
+
+	for encoding, payload := range map[string][]byte{EncodingGzip: gz.Bytes(), EncodingZstd: zs.Bytes()} {
+		if _, err := decodePayload(encoding, payload); !errors.Is(err, errDecodedTooLarge) {
+			t.Errorf("%s bomb of %d bytes: %v, want %v", encoding, len(payload), err, errDecodedTooLarge)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -2,23 +2,48 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
 	"time"
 
 	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/format"
 	"github.com/jalapeno/config-pub/internal/gnmi"
 	"github.com/segmentio/kafka-go"
 )
 
 type Publisher struct {
-	writer *kafka.Writer
-	topic  string
-	maxMsg int
+	writer   *kafka.Writer
+	topic    string
+	maxMsg   int
+	encoding string
+	compress bool
+	chunk    bool
+	codec    *format.Codec
 }
 
+// Delivery describes where a published payload landed. For chunked payloads
+// Offset is that of the first chunk; it is -1 when the broker did not report
+// one (required_acks: none).
+type Delivery struct {
+	Partition   int
+	Offset      int64
+	Bytes       int
+	Chunks      int
+	ContentHash string
+}
+
+// delivered is attached to outgoing messages as WriterData so the writer's
+// completion callback can report the assigned offset back to Publish.
+type delivered struct {
+	partition int
+	offset    int64
+}
+
+// BatchOverhead leaves room for record framing on top of a full-size message.
+const BatchOverhead = 64 * 1024
+
 func NewPublisher(cfg config.KafkaConfig) (*Publisher, error) {
 	if len(cfg.Brokers) == 0 {
 		return nil, fmt.Errorf("kafka brokers are required")
@@ -32,39 +57,137 @@ func NewPublisher(cfg config.KafkaConfig) (*Publisher, error) {
 		}
 	}
 
+	compression, err := parseCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encodePayload(cfg.PayloadEncoding, nil); err != nil {
+		return nil, err
+	}
+
+	codec, err := newCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(cfg.Brokers...),
 		Topic:        cfg.Topic,
 		Balancer:     &kafka.Hash{},
 		RequiredAcks: parseAcks(cfg.RequiredAcks),
 		BatchTimeout: cfg.BatchTimeout,
+		Compression:  compression,
+		Completion:   recordDelivery,
+	}
+	if cfg.MaxMessageSize > 0 {
+		writer.BatchBytes = int64(cfg.MaxMessageSize + BatchOverhead)
+	}
+	return &Publisher{
+		writer:   writer,
+		topic:    cfg.Topic,
+		maxMsg:   cfg.MaxMessageSize,
+		encoding: cfg.PayloadEncoding,
+		compress: cfg.CompressOversize,
+		chunk:    cfg.ChunkOversize,
+		codec:    codec,
+	}, nil
+}
+
+func newCodec(cfg config.KafkaConfig) (*format.Codec, error) {
+	var registry format.Registry
+	if cfg.SchemaRegistry.URL != "" {
+		httpRegistry, err := format.NewHTTPRegistry(format.RegistryConfig{
+			URL:      cfg.SchemaRegistry.URL,
+			Username: cfg.SchemaRegistry.Username,
+			Password: cfg.SchemaRegistry.Password,
+			Timeout:  cfg.SchemaRegistry.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		registry = httpRegistry
 	}
-	return &Publisher{writer: writer, topic: cfg.Topic, maxMsg: cfg.MaxMessageSize}, nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return format.NewCodec(ctx, cfg.Format, registry, cfg.SchemaRegistry.Subject)
 }
 
-func (p *Publisher) Publish(ctx context.Context, host config.HostResolved, msg *gnmi.ConfigMessage) error {
+func (p *Publisher) Publish(ctx context.Context, host config.HostResolved, msg *gnmi.ConfigMessage) (Delivery, error) {
 	if msg == nil {
-		return fmt.Errorf("nil message")
+		return Delivery{}, fmt.Errorf("nil message")
 	}
 
-	payload, err := json.Marshal(msg)
+	payload, err := p.codec.Marshal(msg)
 	if err != nil {
-		return err
-	}
-	if p.maxMsg > 0 && len(payload) > p.maxMsg {
-		return fmt.Errorf("message too large: %d bytes (max %d)", len(payload), p.maxMsg)
+		return Delivery{}, err
 	}
 
 	key := host.Name
 	if key == "" {
 		key = host.Address
 	}
+	now := time.Now().UTC()
+
+	env := Envelope{
+		SchemaVersion:      SchemaVersion,
+		Producer:           "config-pub/" + ProducerVersion,
+		ContentType:        p.codec.ContentType(),
+		ContentEncoding:    p.encoding,
+		ContentHash:        checksum(payload),
+		CollectionDuration: msg.CollectionDuration,
+	}
+	if (env.ContentEncoding == "" || env.ContentEncoding == EncodingIdentity) && p.compress && p.maxMsg > 0 && len(payload) > p.maxMsg {
+		env.ContentEncoding = EncodingGzip
+	}
+	payload, err = encodePayload(env.ContentEncoding, payload)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("encode payload: %w", err)
+	}
+	headers := env.headers()
 
-	return p.writer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(key),
-		Value: payload,
-		Time:  time.Now().UTC(),
-	})
+	var msgs []kafka.Message
+	if p.maxMsg > 0 && len(payload) > p.maxMsg {
+		if !p.chunk {
+			return Delivery{}, fmt.Errorf("message too large: %d bytes (max %d)", len(payload), p.maxMsg)
+		}
+		msgs, err = SplitChunks([]byte(key), payload, p.maxMsg, headers, now)
+		if err != nil {
+			return Delivery{}, err
+		}
+	} else {
+		msgs = []kafka.Message{{
+			Key:     []byte(key),
+			Value:   payload,
+			Headers: headers,
+			Time:    now,
+		}}
+	}
+
+	first := &delivered{offset: -1}
+	msgs[0].WriterData = first
+	if err := p.writer.WriteMessages(ctx, msgs...); err != nil {
+		return Delivery{}, err
+	}
+	return Delivery{
+		Partition:   first.partition,
+		Offset:      first.offset,
+		Bytes:       len(payload),
+		Chunks:      len(msgs),
+		ContentHash: env.ContentHash,
+	}, nil
+}
+
+// recordDelivery runs before a synchronous WriteMessages returns.
+func recordDelivery(messages []kafka.Message, err error) {
+	if err != nil {
+		return
+	}
+	for _, m := range messages {
+		if d, ok := m.WriterData.(*delivered); ok {
+			d.partition, d.offset = m.Partition, m.Offset
+		}
+	}
 }
 
 func (p *Publisher) Close() error {
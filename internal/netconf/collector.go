@@ -0,0 +1,265 @@
+package netconf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/cli"
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/credential"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+const (
+	defaultPort = 830
+
+	// Encoding matches the gNMI encoding whose value shape the trees follow.
+	Encoding = "json_ietf"
+)
+
+// Collector collects hosts with NETCONF over SSH.
+type Collector struct {
+	creds *credential.Store
+}
+
+func NewCollector() *Collector {
+	return &Collector{creds: credential.NewStore()}
+}
+
+// Collect fetches the host's running config, retrying once with fresh
+// credentials if the device rejects them.
+func (c *Collector) Collect(ctx context.Context, host config.HostResolved) (*gnmi.ConfigMessage, error) {
+	var msg *gnmi.ConfigMessage
+	err := c.creds.WithRetry(ctx, host, cli.IsAuthError, func(creds credential.Credentials) error {
+		var err error
+		msg, err = c.collect(ctx, host, creds)
+		return err
+	})
+	return msg, err
+}
+
+// Retain is a no-op: every collection uses its own session.
+func (c *Collector) Retain(names []string) {}
+
+func (c *Collector) Close() error {
+	return nil
+}
+
+func (c *Collector) collect(ctx context.Context, host config.HostResolved, creds credential.Credentials) (*gnmi.ConfigMessage, error) {
+	var settings config.NetconfConfig
+	if host.Netconf != nil {
+		settings = *host.Netconf
+	}
+	port := settings.Port
+	if port == 0 {
+		port = defaultPort
+	}
+
+	timeout := host.RequestTimeout
+	if settings.Timeout > 0 {
+		timeout = settings.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	client, err := cli.Dial(ctx, host, config.SSHConfig{
+		Port:       port,
+		KeyFile:    settings.KeyFile,
+		KnownHosts: settings.KnownHosts,
+	}, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	sshSession, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sshSession.Close()
+	stdin, err := sshSession.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := sshSession.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := sshSession.RequestSubsystem("netconf"); err != nil {
+		return nil, fmt.Errorf("netconf subsystem: %w", err)
+	}
+
+	msg, err := Run(struct {
+		io.Reader
+		io.Writer
+	}{stdout, stdin}, host, settings)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("netconf %s: %w", host.Name, ctx.Err())
+		}
+		return nil, fmt.Errorf("netconf %s: %w", host.Name, err)
+	}
+	msg.CollectionDuration = time.Since(start)
+	return msg, nil
+}
+
+// Run collects the host's paths over an established NETCONF transport. Each
+// path is one <get-config>; failed paths are recorded on the message and the
+// host only fails when nothing could be collected.
+func Run(rw io.ReadWriter, host config.HostResolved, settings config.NetconfConfig) (*gnmi.ConfigMessage, error) {
+	session, err := NewSession(rw)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if settings.Filter == FilterXPath && !session.HasCapability(CapabilityXPath) {
+		return nil, errors.New("server does not support xpath filters")
+	}
+	modules := session.Modules()
+	for module, ns := range settings.Namespaces {
+		modules[module] = ns
+	}
+
+	paths := host.Paths
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	msg := &gnmi.ConfigMessage{
+		Target:   host.Target,
+		Address:  host.Address,
+		Encoding: Encoding,
+		Type:     host.Type,
+		Updates:  []gnmi.ConfigUpdate{},
+	}
+
+	var firstErr error
+	failed := 0
+	for _, raw := range paths {
+		label := strings.TrimSpace(raw)
+		value, found, err := getPath(session, settings.Filter, label, modules)
+		var transportErr *transportError
+		if errors.As(err, &transportErr) {
+			// The session is unusable after a transport or framing error.
+			return nil, transportErr.err
+		}
+		if err != nil {
+			log.Printf("get-config %s failed for %s (%s): %v", label, host.Name, host.Address, err)
+			msg.Errors = append(msg.Errors, gnmi.CollectError{Path: label, Error: err.Error()})
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if found {
+			msg.Updates = append(msg.Updates, gnmi.ConfigUpdate{Path: label, Value: value, Type: Encoding})
+		}
+	}
+	if failed == len(paths) {
+		return nil, fmt.Errorf("all %d requests failed: %w", len(paths), firstErr)
+	}
+
+	msg.Timestamp = time.Now().UTC()
+	if len(msg.Updates) == 0 {
+		msg.Updates = append(msg.Updates, gnmi.ConfigUpdate{
+			Path:  "/",
+			Value: json.RawMessage("{}"),
+			Type:  "empty",
+		})
+	}
+	return msg, nil
+}
+
+func getPath(session *Session, kind, raw string, modules map[string]string) (interface{}, bool, error) {
+	path, err := gnmi.ParsePath(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	filter, err := Filter(kind, path, modules)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := session.GetConfig(filter)
+	var rpcErr *RPCError
+	if err != nil && !errors.As(err, &rpcErr) {
+		return nil, false, &transportError{err}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data.Children) == 0 {
+		return nil, false, nil
+	}
+
+	// Like a gNMI Get, the value is the subtree at the path.
+	var value interface{} = Tree(data, modules)
+	for _, pe := range path.GetElem() {
+		value = descend(value, pe.GetName(), pe.GetKey())
+		if value == nil {
+			return nil, false, nil
+		}
+	}
+	return value, true, nil
+}
+
+// transportError ends the collection instead of failing one path.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return e.err.Error() }
+
+func descend(value interface{}, name string, keys map[string]string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	_, local, found := strings.Cut(name, ":")
+	if !found {
+		local = name
+	}
+	var next interface{}
+	for member, v := range obj {
+		if member == local || strings.HasSuffix(member, ":"+local) {
+			next = v
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return next
+	}
+	entries, ok := next.([]interface{})
+	if !ok {
+		return next
+	}
+	for _, entry := range entries {
+		if matchKeys(entry, keys) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func matchKeys(entry interface{}, keys map[string]string) bool {
+	obj, ok := entry.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, want := range keys {
+		if got, ok := obj[k].(string); !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+const (
+	FilterSubtree = "subtree"
+	FilterXPath   = "xpath"
+)
+
+// Filter builds the <filter> element selecting a gNMI-style path such as
+// "/openconfig-interfaces:interfaces/interface[name=eth0]". The first element
+// must name its module; later elements inherit it until another prefix
+// appears. The root path selects everything and needs no filter.
+func Filter(kind string, path *gpb.Path, modules map[string]string) (string, error) {
+	if len(path.GetElem()) == 0 {
+		return "", nil
+	}
+	elems, err := qualify(path, modules)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case "", FilterSubtree:
+		return subtree(elems), nil
+	case FilterXPath:
+		return xpath(elems), nil
+	default:
+		return "", fmt.Errorf("unsupported netconf filter %q", kind)
+	}
+}
+
+type elem struct {
+	module string
+	ns     string
+	name   string
+	keys   []key
+}
+
+type key struct {
+	name  string
+	value string
+}
+
+func qualify(path *gpb.Path, modules map[string]string) ([]elem, error) {
+	elems := make([]elem, 0, len(path.GetElem()))
+	var module, ns string
+	for i, pe := range path.GetElem() {
+		name := pe.GetName()
+		if prefix, local, ok := strings.Cut(name, ":"); ok {
+			module, name = prefix, local
+			var known bool
+			if ns, known = modules[module]; !known {
+				return nil, fmt.Errorf("no namespace for module %q; the server did not announce it", module)
+			}
+		} else if i == 0 {
+			return nil, fmt.Errorf("path element %q needs a module prefix", name)
+		}
+		e := elem{module: module, ns: ns, name: name}
+		for k, v := range pe.GetKey() {
+			e.keys = append(e.keys, key{name: k, value: v})
+		}
+		sort.Slice(e.keys, func(a, b int) bool { return e.keys[a].name < e.keys[b].name })
+		elems = append(elems, e)
+	}
+	return elems, nil
+}
+
+func subtree(elems []elem) string {
+	var b strings.Builder
+	b.WriteString(`<filter type="subtree">`)
+	parentNS := ""
+	for _, e := range elems {
+		b.WriteString("<" + e.name)
+		if e.ns != parentNS {
+			b.WriteString(` xmlns="` + escape(e.ns) + `"`)
+			parentNS = e.ns
+		}
+		b.WriteString(">")
+		// Content match nodes select the list entry.
+		for _, k := range e.keys {
+			b.WriteString("<" + k.name + ">" + escape(k.value) + "</" + k.name + ">")
+		}
+	}
+	for i := len(elems) - 1; i >= 0; i-- {
+		b.WriteString("</" + elems[i].name + ">")
+	}
+	b.WriteString(`</filter>`)
+	return b.String()
+}
+
+func xpath(elems []elem) string {
+	prefixes := map[string]string{}
+	var decls strings.Builder
+	var sel strings.Builder
+	for _, e := range elems {
+		prefix, ok := prefixes[e.ns]
+		if !ok {
+			prefix = fmt.Sprintf("m%d", len(prefixes))
+			prefixes[e.ns] = prefix
+			decls.WriteString(` xmlns:` + prefix + `="` + escape(e.ns) + `"`)
+		}
+		sel.WriteString("/" + prefix + ":" + e.name)
+		for _, k := range e.keys {
+			sel.WriteString("[" + prefix + ":" + k.name + "=" + quote(k.value) + "]")
+		}
+	}
+	return `<filter type="xpath"` + decls.String() + ` select="` + escape(sel.String()) + `"/>`
+}
+
+// quote makes an XPath string literal; XPath 1.0 has no escapes, so a value
+// with a single quote is wrapped in double quotes.
+func quote(v string) string {
+	if strings.Contains(v, "'") {
+		return `"` + v + `"`
+	}
+	return "'" + v + "'"
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
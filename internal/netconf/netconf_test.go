@@ -0,0 +1,325 @@
+package netconf
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/jalapeno/config-pub/internal/gnmi"
+)
+
+const (
+	interfacesNS = "http://openconfig.net/yang/interfaces"
+	systemNS     = "http://openconfig.net/yang/system"
+)
+
+// standIn is a local NETCONF server on one end of a pipe. It announces
+// capabilities, records every rpc it receives and answers each with reply,
+// which returns the body of the rpc-reply; a reply with several bodies is
+// sent as one chunk each in base:1.1 framing.
+type standIn struct {
+	capabilities []string
+	reply        func(rpc string) []string
+
+	mu       sync.Mutex
+	rpcs     []string
+	clientHi string
+}
+
+func (s *standIn) serve(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	sess := &Session{r: bufio.NewReader(conn), w: conn}
+
+	hello, err := sess.read()
+	if err != nil {
+		t.Errorf("stand-in: read hello: %v", err)
+		return
+	}
+	var caps strings.Builder
+	for _, c := range s.capabilities {
+		caps.WriteString("<capability>" + c + "</capability>")
+	}
+	if err := sess.write([]byte(`<hello xmlns="` + baseNS + `"><capabilities>` + caps.String() + `</capabilities><session-id>1</session-id></hello>`)); err != nil {
+		t.Errorf("stand-in: send hello: %v", err)
+		return
+	}
+	s.mu.Lock()
+	s.clientHi = string(hello)
+	s.mu.Unlock()
+	sess.chunked = slices.Contains(s.capabilities, CapabilityBase11) && strings.Contains(string(hello), CapabilityBase11)
+
+	for {
+		raw, err := sess.read()
+		if err != nil {
+			return
+		}
+		rpc := string(raw)
+		s.mu.Lock()
+		s.rpcs = append(s.rpcs, rpc)
+		s.mu.Unlock()
+
+		bodies := []string{"<ok/>"}
+		if !strings.Contains(rpc, "<close-session/>") {
+			bodies = s.reply(rpc)
+		}
+		start := `<rpc-reply message-id="` + messageID(rpc) + `" xmlns="` + baseNS + `">`
+		bodies[0] = start + bodies[0]
+		bodies[len(bodies)-1] += `</rpc-reply>`
+		if err := s.send(sess, bodies); err != nil {
+			t.Errorf("stand-in: send reply: %v", err)
+			return
+		}
+		if strings.Contains(rpc, "<close-session/>") {
+			return
+		}
+	}
+}
+
+func (s *standIn) send(sess *Session, parts []string) error {
+	if !sess.chunked || len(parts) == 1 {
+		return sess.write([]byte(strings.Join(parts, "")))
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		fmt.Fprintf(&b, "\n#%d\n%s", len(p), p)
+	}
+	b.WriteString("\n##\n")
+	_, err := sess.w.Write([]byte(b.String()))
+	return err
+}
+
+func messageID(rpc string) string {
+	_, rest, _ := strings.Cut(rpc, `message-id="`)
+	id, _, _ := strings.Cut(rest, `"`)
+	return id
+}
+
+func (s *standIn) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.rpcs...)
+}
+
+// run collects paths from server over a pipe.
+func run(t *testing.T, server *standIn, paths []string, settings config.NetconfConfig) (*gnmi.ConfigMessage, error) {
+	t.Helper()
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.serve(t, conn)
+	}()
+	defer func() {
+		client.Close()
+		<-done
+	}()
+	host := config.HostResolved{Name: "r1", Address: "10.0.0.1:830", Target: "r1", Type: "config", Paths: paths}
+	return Run(client, host, settings)
+}
+
+func interfaceData(names ...string) string {
+	var b strings.Builder
+	b.WriteString(`<data><interfaces xmlns="` + interfacesNS + `">`)
+	for _, name := range names {
+		b.WriteString(`<interface><name>` + name + `</name><config><name>` + name + `</name><mtu>9000</mtu><enabled/></config></interface>`)
+	}
+	b.WriteString(`</interfaces></data>`)
+	return b.String()
+}
+
+const rpcFailure = `<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag>` +
+	`<error-severity>error</error-severity><error-message>no such subtree</error-message></rpc-error>`
+
+func TestRunEndOfMessageSubtree(t *testing.T) {
+	server := &standIn{
+		capabilities: []string{
+			CapabilityBase10,
+			interfacesNS + "?module=openconfig-interfaces&amp;revision=2021-04-06",
+			systemNS + "?module=openconfig-system",
+		},
+		reply: func(rpc string) []string {
+			if strings.Contains(rpc, systemNS) {
+				return []string{rpcFailure}
+			}
+			return []string{interfaceData("eth0")}
+		},
+	}
+	msg, err := run(t, server, []string{"/openconfig-interfaces:interfaces/interface[name=eth0]", "/openconfig-system:system"}, config.NetconfConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(server.clientHi, CapabilityBase11) {
+		t.Errorf("client hello does not offer base:1.1: %s", server.clientHi)
+	}
+	rpcs := server.requests()
+	if len(rpcs) != 3 {
+		t.Fatalf("got %d rpcs, want two get-config and close-session: %q", len(rpcs), rpcs)
+	}
+	wantFilter := `<filter type="subtree"><interfaces xmlns="` + interfacesNS + `"><interface><name>eth0</name></interface></interfaces></filter>`
+	if !strings.Contains(rpcs[0], `<get-config><source><running/></source>`+wantFilter+`</get-config>`) {
+		t.Errorf("first rpc %s\nwant filter %s", rpcs[0], wantFilter)
+	}
+	if !strings.Contains(rpcs[2], "<close-session/>") {
+		t.Errorf("last rpc %s, want close-session", rpcs[2])
+	}
+
+	// The value is the subtree at the path, as a gNMI Get returns it.
+	want := []gnmi.ConfigUpdate{{
+		Path: "/openconfig-interfaces:interfaces/interface[name=eth0]",
+		Value: map[string]interface{}{
+			"name": "eth0",
+			"config": map[string]interface{}{
+				"name":    "eth0",
+				"mtu":     "9000",
+				"enabled": []interface{}{nil},
+			},
+		},
+		Type: Encoding,
+	}}
+	if !reflect.DeepEqual(msg.Updates, want) {
+		t.Errorf("updates\n got %#v\nwant %#v", msg.Updates, want)
+	}
+	wantErrs := []gnmi.CollectError{{Path: "/openconfig-system:system", Error: "rpc-error: operation-failed: no such subtree"}}
+	if !reflect.DeepEqual(msg.Errors, wantErrs) {
+		t.Errorf("errors %#v, want %#v", msg.Errors, wantErrs)
+	}
+	if msg.Target != "r1" || msg.Encoding != Encoding || msg.Timestamp.IsZero() {
+		t.Errorf("message header %+v", msg)
+	}
+}
+
+func TestRunChunkedXPath(t *testing.T) {
+	server := &standIn{
+		capabilities: []string{
+			CapabilityBase10,
+			CapabilityBase11,
+			CapabilityXPath,
+			interfacesNS + "?module=openconfig-interfaces",
+		},
+		reply: func(rpc string) []string {
+			// A warning does not fail the request; the data spans chunks.
+			data := interfaceData("eth0")
+			return []string{
+				`<rpc-error><error-tag>partial-operation</error-tag><error-severity>warning</error-severity></rpc-error>`,
+				data[:20],
+				data[20:],
+			}
+		},
+	}
+	msg, err := run(t, server, []string{"/openconfig-interfaces:interfaces/interface[name=eth0]/config/mtu"}, config.NetconfConfig{Filter: FilterXPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpcs := server.requests()
+	wantFilter := `<filter type="xpath" xmlns:m0="` + interfacesNS + `" select="/m0:interfaces/m0:interface[m0:name=&#39;eth0&#39;]/m0:config/m0:mtu"/>`
+	if len(rpcs) == 0 || !strings.Contains(rpcs[0], wantFilter) {
+		t.Fatalf("rpcs %q\nwant filter %s", rpcs, wantFilter)
+	}
+	if len(msg.Updates) != 1 || msg.Updates[0].Value != "9000" {
+		t.Errorf("updates %#v, want the mtu leaf", msg.Updates)
+	}
+	if len(msg.Errors) != 0 {
+		t.Errorf("errors %#v, want none", msg.Errors)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		caps     []string
+		settings config.NetconfConfig
+		paths    []string
+		wantErr  string
+	}{
+		{
+			name:    "every path fails",
+			caps:    []string{CapabilityBase11, interfacesNS + "?module=openconfig-interfaces"},
+			paths:   []string{"/openconfig-interfaces:interfaces", "/openconfig-interfaces:interfaces/interface[name=eth1]"},
+			wantErr: "all 2 requests failed: rpc-error: operation-failed: no such subtree",
+		},
+		{
+			name:     "xpath not offered",
+			caps:     []string{CapabilityBase11, interfacesNS + "?module=openconfig-interfaces"},
+			settings: config.NetconfConfig{Filter: FilterXPath},
+			paths:    []string{"/openconfig-interfaces:interfaces"},
+			wantErr:  "server does not support xpath filters",
+		},
+		{
+			name:    "module not announced",
+			caps:    []string{CapabilityBase10},
+			paths:   []string{"/openconfig-interfaces:interfaces"},
+			wantErr: `no namespace for module "openconfig-interfaces"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &standIn{
+				capabilities: tt.caps,
+				reply:        func(string) []string { return []string{rpcFailure} },
+			}
+			_, err := run(t, server, tt.paths, tt.settings)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	data, err := parseXML([]byte(`<data xmlns="` + baseNS + `">` +
+		`<interfaces xmlns="` + interfacesNS + `">` +
+		`<interface><name>eth0</name></interface>` +
+		`<interface><name>eth1</name><config><description/></config></interface>` +
+		`</interfaces>` +
+		`<system xmlns="` + systemNS + `"><config><hostname>r1</hostname></config></system>` +
+		`</data>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Tree(data, map[string]string{
+		"openconfig-interfaces": interfacesNS,
+		"openconfig-system":     systemNS,
+	})
+	want := map[string]interface{}{
+		"openconfig-interfaces:interfaces": map[string]interface{}{
+			"interface": []interface{}{
+				map[string]interface{}{"name": "eth0"},
+				map[string]interface{}{
+					"name":   "eth1",
+					"config": map[string]interface{}{"description": []interface{}{nil}},
+				},
+			},
+		},
+		"openconfig-system:system": map[string]interface{}{
+			"config": map[string]interface{}{"hostname": "r1"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tree\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestReadChunkedLimits(t *testing.T) {
+	tests := map[string]string{
+		"oversized chunk": fmt.Sprintf("\n#%d\n", maxChunk+1),
+		"bad size":        "\n#-4\n",
+		"overlong header": "\n#" + strings.Repeat("1", 8192),
+	}
+	for name, stream := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &Session{r: bufio.NewReader(strings.NewReader(stream)), chunked: true}
+			if _, err := s.read(); err == nil {
+				t.Fatal("read succeeded")
+			}
+		})
+	}
+}
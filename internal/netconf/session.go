@@ -0,0 +1,263 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	baseNS = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+	CapabilityBase10 = "urn:ietf:params:netconf:base:1.0"
+	CapabilityBase11 = "urn:ietf:params:netconf:base:1.1"
+	CapabilityXPath  = "urn:ietf:params:netconf:capability:xpath:1.0"
+
+	endOfMessage = "]]>]]>"
+
+	// maxChunk bounds one base:1.1 chunk and maxMessage a whole reply, in
+	// either framing, so a broken server cannot exhaust memory.
+	maxChunk   = 4 << 20
+	maxMessage = 256 << 20
+)
+
+// Session is a NETCONF session over any byte stream, usually the "netconf"
+// SSH subsystem. It speaks base:1.1 chunked framing when the server offers
+// it and end-of-message framing otherwise.
+type Session struct {
+	r       *bufio.Reader
+	w       io.Writer
+	chunked bool
+	msgID   int
+
+	// Capabilities are the ones the server announced in its hello.
+	Capabilities []string
+}
+
+// NewSession exchanges hellos with the server.
+func NewSession(rw io.ReadWriter) (*Session, error) {
+	s := &Session{r: bufio.NewReader(rw), w: rw}
+
+	hello := `<hello xmlns="` + baseNS + `"><capabilities>` +
+		`<capability>` + CapabilityBase10 + `</capability>` +
+		`<capability>` + CapabilityBase11 + `</capability>` +
+		`</capabilities></hello>`
+	// Both sides send their hello at once; writing in the background keeps
+	// an unbuffered transport from deadlocking.
+	sent := make(chan error, 1)
+	go func() { sent <- s.write([]byte(hello)) }()
+
+	raw, err := s.read()
+	if err != nil {
+		return nil, fmt.Errorf("read hello: %w", err)
+	}
+	if err := <-sent; err != nil {
+		return nil, fmt.Errorf("send hello: %w", err)
+	}
+	var reply struct {
+		Capabilities []string `xml:"capabilities>capability"`
+	}
+	if err := xml.Unmarshal(raw, &reply); err != nil {
+		return nil, fmt.Errorf("parse hello: %w", err)
+	}
+	s.Capabilities = reply.Capabilities
+	s.chunked = s.HasCapability(CapabilityBase11)
+	return s, nil
+}
+
+func (s *Session) HasCapability(capability string) bool {
+	for _, c := range s.Capabilities {
+		if c == capability || strings.HasPrefix(c, capability+"?") {
+			return true
+		}
+	}
+	return false
+}
+
+// Modules maps the YANG modules announced as capabilities to their
+// namespaces.
+func (s *Session) Modules() map[string]string {
+	modules := map[string]string{}
+	for _, c := range s.Capabilities {
+		ns, query, ok := strings.Cut(c, "?")
+		if !ok {
+			continue
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			continue
+		}
+		if module := values.Get("module"); module != "" {
+			modules[module] = ns
+		}
+	}
+	return modules
+}
+
+// GetConfig runs <get-config> on the running datastore and returns the
+// reply's <data> element. filter is a <filter> element or empty.
+func (s *Session) GetConfig(filter string) (*Node, error) {
+	reply, err := s.rpc(`<get-config><source><running/></source>` + filter + `</get-config>`)
+	if err != nil {
+		return nil, err
+	}
+	data := reply.child("data")
+	if data == nil {
+		return &Node{Name: xml.Name{Space: baseNS, Local: "data"}}, nil
+	}
+	return data, nil
+}
+
+// Close ends the session politely; the caller still closes the transport.
+func (s *Session) Close() error {
+	_, err := s.rpc(`<close-session/>`)
+	return err
+}
+
+func (s *Session) rpc(body string) (*Node, error) {
+	s.msgID++
+	id := strconv.Itoa(s.msgID)
+	if err := s.write([]byte(`<rpc message-id="` + id + `" xmlns="` + baseNS + `">` + body + `</rpc>`)); err != nil {
+		return nil, err
+	}
+	raw, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := parseXML(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse rpc-reply: %w", err)
+	}
+	if reply.Name.Local != "rpc-reply" {
+		return nil, fmt.Errorf("unexpected reply <%s>", reply.Name.Local)
+	}
+	if err := rpcError(reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// RPCError is an <rpc-error> the server returned.
+type RPCError struct {
+	Tag     string
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	if e.Message == "" {
+		return "rpc-error: " + e.Tag
+	}
+	return "rpc-error: " + e.Tag + ": " + e.Message
+}
+
+func rpcError(reply *Node) error {
+	var errs []error
+	for _, child := range reply.Children {
+		if child.Name.Local != "rpc-error" {
+			continue
+		}
+		// Warnings do not fail the request.
+		if severity := child.child("error-severity"); severity != nil && strings.TrimSpace(severity.Text) == "warning" {
+			continue
+		}
+		e := &RPCError{}
+		if tag := child.child("error-tag"); tag != nil {
+			e.Tag = strings.TrimSpace(tag.Text)
+		}
+		if msg := child.child("error-message"); msg != nil {
+			e.Message = strings.TrimSpace(msg.Text)
+		}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Session) write(msg []byte) error {
+	var buf bytes.Buffer
+	if s.chunked {
+		fmt.Fprintf(&buf, "\n#%d\n", len(msg))
+		buf.Write(msg)
+		buf.WriteString("\n##\n")
+	} else {
+		buf.Write(msg)
+		buf.WriteString(endOfMessage)
+	}
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+func (s *Session) read() ([]byte, error) {
+	if s.chunked {
+		return s.readChunked()
+	}
+	var msg []byte
+	for {
+		part, err := s.r.ReadSlice('>')
+		msg = append(msg, part...)
+		if bytes.HasSuffix(msg, []byte(endOfMessage)) {
+			return msg[:len(msg)-len(endOfMessage)], nil
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+		if len(msg) > maxMessage {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessage)
+		}
+	}
+}
+
+// readChunked reads one message in base:1.1 framing (RFC 6242 section 4.2).
+func (s *Session) readChunked() ([]byte, error) {
+	var msg []byte
+	for {
+		header, err := s.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if header == "\n" {
+			// The newline that starts the chunk header.
+			header, err = s.readLine()
+			if err != nil {
+				return nil, err
+			}
+		}
+		header = strings.TrimSuffix(header, "\n")
+		if header == "##" {
+			return msg, nil
+		}
+		if !strings.HasPrefix(header, "#") {
+			return nil, fmt.Errorf("bad chunk header %q", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("bad chunk size %q", header)
+		}
+		if size > maxChunk {
+			return nil, fmt.Errorf("chunk of %d bytes exceeds %d", size, maxChunk)
+		}
+		if len(msg)+size > maxMessage {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessage)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(s.r, chunk); err != nil {
+			return nil, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+// readLine reads a chunk header line, which fits the read buffer unless the
+// framing is broken.
+func (s *Session) readLine() (string, error) {
+	line, err := s.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("bad chunk header %.20q...", line)
+	}
+	return string(line), err
+}
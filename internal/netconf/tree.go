@@ -0,0 +1,121 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Node is an XML element with its children; Text is the element's own
+// character data.
+type Node struct {
+	Name     xml.Name
+	Children []*Node
+	Text     string
+}
+
+func (n *Node) child(local string) *Node {
+	for _, c := range n.Children {
+		if c.Name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+func parseXML(raw []byte) (*Node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	var stack []*Node
+	var root *Node
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &Node{Name: t.Name}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty document")
+	}
+	return root, nil
+}
+
+// Tree converts the children of a <data> element to the shape of a gNMI
+// json_ietf value (RFC 7951): member names carry the module name where the
+// namespace changes, siblings with the same name become a list, and empty
+// elements become [null]. Without the YANG schema a list with a single entry
+// stays an object and every leaf value is a string.
+func Tree(data *Node, modules map[string]string) map[string]interface{} {
+	return members(data, "", namespaceModules(modules))
+}
+
+func namespaceModules(modules map[string]string) map[string]string {
+	byNS := make(map[string]string, len(modules))
+	for module, ns := range modules {
+		byNS[ns] = module
+	}
+	return byNS
+}
+
+func members(n *Node, ns string, byNS map[string]string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, c := range n.Children {
+		name := c.Name.Local
+		if c.Name.Space != ns {
+			if module, ok := byNS[c.Name.Space]; ok {
+				name = module + ":" + name
+			}
+		}
+		v := value(c, byNS)
+		switch existing := out[name].(type) {
+		case nil:
+			out[name] = v
+		case []interface{}:
+			if isList(existing) {
+				out[name] = append(existing, v)
+				continue
+			}
+			out[name] = []interface{}{existing, v}
+		default:
+			out[name] = []interface{}{existing, v}
+		}
+	}
+	return out
+}
+
+// isList tells a list built from repeated elements apart from the [null]
+// of an empty leaf.
+func isList(v []interface{}) bool {
+	return !(len(v) == 1 && v[0] == nil)
+}
+
+func value(n *Node, byNS map[string]string) interface{} {
+	if len(n.Children) > 0 {
+		return members(n, n.Name.Space, byNS)
+	}
+	if strings.TrimSpace(n.Text) == "" {
+		return []interface{}{nil}
+	}
+	return n.Text
+}
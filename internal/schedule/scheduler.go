@@ -0,0 +1,435 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+	"github.com/robfig/cron/v3"
+)
+
+var ErrUnknownHost = errors.New("unknown host")
+
+// Job collects and publishes one host.
+type Job func(ctx context.Context, host config.HostResolved) Result
+
+// Result is the outcome of one Job run. Started and Duration are filled in
+// by the scheduler.
+type Result struct {
+	Started    time.Time
+	Duration   time.Duration
+	Bytes      int
+	ConfigHash string
+	Partition  int
+	Offset     int64
+	Err        error
+}
+
+// HostState is the scheduling and collection state of one host.
+type HostState struct {
+	Name        string     `json:"name"`
+	Groups      []string   `json:"groups,omitempty"`
+	Paused      bool       `json:"paused"`
+	Running     bool       `json:"running"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	LastHash    string     `json:"last_hash,omitempty"`
+}
+
+// Scheduler runs Job for every host on its own cadence: a cron schedule when
+// one is set, otherwise a fixed interval. The first run of each host is
+// delayed by a random share of its jitter (cron runs are jittered every
+// time) and runs that fall inside a blackout window are skipped. A host is
+// never collected twice at once.
+type Scheduler struct {
+	hosts func() []config.HostResolved
+	job   Job
+	sem   chan struct{}
+	wg    sync.WaitGroup
+	// now is the clock; tests replace it.
+	now func() time.Time
+
+	mu      sync.Mutex
+	ctx     context.Context
+	entries map[string]*entry
+}
+
+type entry struct {
+	host      config.HostResolved
+	key       string
+	cron      cron.Schedule
+	blackouts []blackout
+	next      time.Time
+	invalid   bool
+	*status
+}
+
+// status survives schedule changes of a host.
+type status struct {
+	running bool
+	paused  bool
+	// rerun queues another run, for the waiters, once the current one ends.
+	rerun   bool
+	waiters []func(Result)
+	last    Result
+	success time.Time
+	failure time.Time
+	lastErr string
+	hash    string
+}
+
+type blackout struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// tick is how often due hosts are checked and the host list re-read.
+const tick = time.Second
+
+func New(hosts func() []config.HostResolved, job Job, concurrency int) *Scheduler {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Scheduler{
+		hosts:   hosts,
+		job:     job,
+		sem:     make(chan struct{}, concurrency),
+		now:     time.Now,
+		ctx:     context.Background(),
+		entries: map[string]*entry{},
+	}
+}
+
+// RunOnce collects every host a single time and waits for completion.
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	for _, host := range s.hosts() {
+		s.dispatch(ctx, host, nil)
+	}
+	s.wg.Wait()
+}
+
+// Run schedules hosts until ctx is done, then waits for running jobs.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	s.poll(ctx, s.now())
+	for {
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return
+		case <-ticker.C:
+			s.poll(ctx, s.now())
+		}
+	}
+}
+
+// Trigger collects a host now, outside its schedule and regardless of pause
+// or blackouts. If the host is already being collected another run follows
+// the current one. done, if not nil, receives the result.
+func (s *Scheduler) Trigger(name string, done func(Result)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownHost, name)
+	}
+	if done != nil {
+		e.waiters = append(e.waiters, done)
+	}
+	if e.running {
+		e.rerun = true
+		return nil
+	}
+	e.running = true
+	waiters := e.waiters
+	e.waiters = nil
+	s.dispatch(s.ctx, e.host, waiters)
+	return nil
+}
+
+// Pause stops scheduled collection of a host until Resume.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownHost, name)
+	}
+	if e.paused != paused {
+		e.paused = paused
+		if paused {
+			log.Printf("paused scheduled collection of %s", name)
+		} else {
+			log.Printf("resumed scheduled collection of %s", name)
+		}
+	}
+	return nil
+}
+
+// States lists every scheduled host, sorted by name.
+func (s *Scheduler) States() []HostState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]HostState, 0, len(s.entries))
+	for _, e := range s.entries {
+		states = append(states, e.state())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+func (s *Scheduler) State(name string) (HostState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return HostState{}, fmt.Errorf("%w: %s", ErrUnknownHost, name)
+	}
+	return e.state(), nil
+}
+
+func (e *entry) state() HostState {
+	st := HostState{
+		Name:        e.host.Name,
+		Groups:      e.host.Groups,
+		Paused:      e.paused,
+		Running:     e.running,
+		LastRun:     optionalTime(e.last.Started),
+		LastSuccess: optionalTime(e.success),
+		LastError:   e.lastErr,
+		LastErrorAt: optionalTime(e.failure),
+		LastHash:    e.hash,
+	}
+	if !e.invalid && !e.paused {
+		st.NextRun = optionalTime(e.next)
+	}
+	return st
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func (s *Scheduler) poll(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sync(now)
+	for name, e := range s.entries {
+		if e.invalid || now.Before(e.next) {
+			continue
+		}
+		e.next = e.nextRun(now)
+		if e.paused {
+			continue
+		}
+		if e.running {
+			log.Printf("skipping %s: previous collection still running", name)
+			continue
+		}
+		if e.inBlackout(now) {
+			log.Printf("skipping %s: inside blackout window; next run %s", name, e.next.Format(time.RFC3339))
+			continue
+		}
+		e.running = true
+		s.dispatch(ctx, e.host, nil)
+	}
+}
+
+// dispatch runs the job once a worker slot is free. Callers holding an
+// entry mark it running first.
+func (s *Scheduler) dispatch(ctx context.Context, host config.HostResolved, waiters []func(Result)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			s.finish(ctx, host.Name, Result{Started: s.now(), Err: ctx.Err()}, waiters)
+			return
+		}
+		start := s.now()
+		result := s.job(ctx, host)
+		<-s.sem
+		result.Started = start
+		result.Duration = s.now().Sub(start)
+		s.finish(ctx, host.Name, result, waiters)
+	}()
+}
+
+func (s *Scheduler) finish(ctx context.Context, name string, result Result, waiters []func(Result)) {
+	var cancelled []func(Result)
+	s.mu.Lock()
+	if e, ok := s.entries[name]; ok {
+		e.running = false
+		e.last = result
+		if result.Err != nil {
+			e.failure = result.Started
+			e.lastErr = result.Err.Error()
+		} else {
+			e.success = result.Started
+			e.hash = result.ConfigHash
+		}
+		if e.rerun {
+			e.rerun = false
+			next := e.waiters
+			e.waiters = nil
+			if ctx.Err() == nil {
+				e.running = true
+				s.dispatch(ctx, e.host, next)
+			} else {
+				cancelled = next
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	notify(waiters, result)
+	notify(cancelled, Result{Started: s.now(), Err: ctx.Err()})
+}
+
+func notify(waiters []func(Result), result Result) {
+	for _, done := range waiters {
+		done(result)
+	}
+}
+
+// sync adds, updates and removes entries to match the current host list.
+// Entries whose schedule settings are unchanged keep their next run time.
+func (s *Scheduler) sync(now time.Time) {
+	current := map[string]bool{}
+	for _, host := range s.hosts() {
+		current[host.Name] = true
+		key := scheduleKey(host)
+		e, ok := s.entries[host.Name]
+		if ok && e.key == key {
+			e.host = host
+			continue
+		}
+
+		next := &entry{host: host, key: key, status: &status{}}
+		if ok {
+			next.status = e.status
+		}
+		if err := next.parse(); err != nil {
+			log.Printf("invalid schedule for %s: %v", host.Name, err)
+			next.invalid = true
+		} else {
+			next.next = next.firstRun(now)
+			log.Printf("scheduled %s: %s; first run %s", host.Name, next.describe(), next.next.Format(time.RFC3339))
+		}
+		s.entries[host.Name] = next
+	}
+
+	for name, e := range s.entries {
+		if current[name] {
+			continue
+		}
+		if len(e.waiters) > 0 {
+			go notify(e.waiters, Result{Started: now, Err: fmt.Errorf("%w: %s removed from inventory", ErrUnknownHost, name)})
+		}
+		delete(s.entries, name)
+	}
+}
+
+func scheduleKey(host config.HostResolved) string {
+	return fmt.Sprintf("%s|%s|%s|%v", host.Interval, host.Schedule, host.Jitter, host.Blackouts)
+}
+
+func (e *entry) parse() error {
+	if e.host.Schedule != "" {
+		sched, err := cron.ParseStandard(e.host.Schedule)
+		if err != nil {
+			return fmt.Errorf("schedule %q: %w", e.host.Schedule, err)
+		}
+		e.cron = sched
+	} else if e.host.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	for _, b := range e.host.Blackouts {
+		sched, err := cron.ParseStandard(b.Cron)
+		if err != nil {
+			return fmt.Errorf("blackout %q: %w", b.Cron, err)
+		}
+		if b.Duration <= 0 {
+			return fmt.Errorf("blackout %q: duration must be positive", b.Cron)
+		}
+		e.blackouts = append(e.blackouts, blackout{schedule: sched, duration: b.Duration})
+	}
+	return nil
+}
+
+func (e *entry) describe() string {
+	if e.cron != nil {
+		return "cron " + e.host.Schedule
+	}
+	return "every " + e.host.Interval.String()
+}
+
+func (e *entry) firstRun(now time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.Next(now).Add(jitter(e.host.Jitter))
+	}
+	return now.Add(jitter(e.host.Jitter))
+}
+
+func (e *entry) nextRun(now time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.Next(now).Add(jitter(e.host.Jitter))
+	}
+	next := e.next
+	for !next.After(now) {
+		next = next.Add(e.host.Interval)
+	}
+	return next
+}
+
+// inBlackout reports whether a blackout window activated within its
+// duration before now.
+func (e *entry) inBlackout(now time.Time) bool {
+	for _, b := range e.blackouts {
+		if !b.schedule.Next(now.Add(-b.duration)).After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
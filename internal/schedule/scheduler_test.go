@@ -0,0 +1,267 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+// fakeClock is a settable clock for the scheduler.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// recorder is a Job that counts runs per host; if release is set each run
+// waits for a value on it.
+type recorder struct {
+	mu      sync.Mutex
+	runs    map[string]int
+	release chan struct{}
+}
+
+func (r *recorder) job(ctx context.Context, host config.HostResolved) Result {
+	if r.release != nil {
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[host.Name]++
+	return Result{ConfigHash: "sha256:" + host.Name}
+}
+
+func (r *recorder) count(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runs[name]
+}
+
+func newTestScheduler(t *testing.T, start time.Time, hosts ...config.HostResolved) (*Scheduler, *fakeClock, *recorder) {
+	t.Helper()
+	clock := &fakeClock{now: start}
+	rec := &recorder{runs: map[string]int{}}
+	s := New(func() []config.HostResolved { return hosts }, rec.job, 1)
+	s.now = clock.Now
+	return s, clock, rec
+}
+
+// pollAt moves the clock to t, polls and waits for the runs it started.
+func pollAt(s *Scheduler, clock *fakeClock, t time.Time) {
+	clock.Set(t)
+	s.poll(context.Background(), t)
+	s.wg.Wait()
+}
+
+var t0 = time.Date(2026, 3, 2, 10, 3, 0, 0, time.UTC)
+
+func TestSchedulerInterval(t *testing.T) {
+	s, clock, rec := newTestScheduler(t, t0, config.HostResolved{Name: "r1", Interval: time.Minute})
+
+	steps := []struct {
+		at   time.Duration
+		runs int
+	}{
+		{0, 1},
+		{30 * time.Second, 1},
+		{time.Minute, 2},
+		{90 * time.Second, 2},
+		// A missed run is not made up for; the next is on the grid.
+		{5*time.Minute + 10*time.Second, 3},
+		{5*time.Minute + 50*time.Second, 3},
+		{6 * time.Minute, 4},
+	}
+	for _, step := range steps {
+		pollAt(s, clock, t0.Add(step.at))
+		if got := rec.count("r1"); got != step.runs {
+			t.Fatalf("at +%s: %d runs, want %d", step.at, got, step.runs)
+		}
+	}
+
+	st, err := s.State("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := t0.Add(7 * time.Minute); st.NextRun == nil || !st.NextRun.Equal(want) {
+		t.Errorf("next run %v, want %s", st.NextRun, want)
+	}
+	if want := t0.Add(6 * time.Minute); st.LastSuccess == nil || !st.LastSuccess.Equal(want) || st.LastHash != "sha256:r1" {
+		t.Errorf("state %+v, want last success at %s", st, want)
+	}
+}
+
+func TestSchedulerCron(t *testing.T) {
+	s, clock, rec := newTestScheduler(t, t0, config.HostResolved{Name: "r1", Interval: time.Minute, Schedule: "*/10 * * * *"})
+
+	hour := t0.Truncate(time.Hour)
+	steps := []struct {
+		minute int
+		runs   int
+	}{
+		{3, 0},
+		{9, 0},
+		{10, 1},
+		{15, 1},
+		{20, 2},
+	}
+	for _, step := range steps {
+		pollAt(s, clock, hour.Add(time.Duration(step.minute)*time.Minute))
+		if got := rec.count("r1"); got != step.runs {
+			t.Fatalf("at 10:%02d: %d runs, want %d", step.minute, got, step.runs)
+		}
+	}
+}
+
+func TestSchedulerBlackout(t *testing.T) {
+	start := time.Date(2026, 3, 2, 21, 59, 0, 0, time.UTC)
+	s, clock, rec := newTestScheduler(t, start, config.HostResolved{
+		Name:      "r1",
+		Interval:  30 * time.Minute,
+		Blackouts: []config.Blackout{{Cron: "0 22 * * *", Duration: 2 * time.Hour}},
+	})
+
+	pollAt(s, clock, start)
+	for _, at := range []time.Duration{31 * time.Minute, 61 * time.Minute, 91 * time.Minute} {
+		pollAt(s, clock, start.Add(at))
+	}
+	if got := rec.count("r1"); got != 1 {
+		t.Fatalf("%d runs during the blackout, want only the one before it", got)
+	}
+	pollAt(s, clock, start.Add(121*time.Minute))
+	if got := rec.count("r1"); got != 2 {
+		t.Fatalf("%d runs after the blackout, want 2", got)
+	}
+}
+
+func TestSchedulerPauseAndTrigger(t *testing.T) {
+	s, clock, rec := newTestScheduler(t, t0, config.HostResolved{Name: "r1", Interval: time.Minute})
+	pollAt(s, clock, t0)
+
+	if err := s.Pause("r1"); err != nil {
+		t.Fatal(err)
+	}
+	pollAt(s, clock, t0.Add(time.Minute))
+	if got := rec.count("r1"); got != 1 {
+		t.Fatalf("%d runs while paused, want 1", got)
+	}
+	if st, _ := s.State("r1"); !st.Paused || st.NextRun != nil {
+		t.Errorf("paused state %+v", st)
+	}
+
+	// Trigger ignores the pause.
+	done := make(chan Result, 1)
+	if err := s.Trigger("r1", func(r Result) { done <- r }); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-done; r.Err != nil || !r.Started.Equal(t0.Add(time.Minute)) {
+		t.Errorf("triggered result %+v", r)
+	}
+	s.wg.Wait()
+
+	if err := s.Resume("r1"); err != nil {
+		t.Fatal(err)
+	}
+	pollAt(s, clock, t0.Add(2*time.Minute))
+	if got := rec.count("r1"); got != 3 {
+		t.Fatalf("%d runs after resume, want 3", got)
+	}
+
+	if err := s.Trigger("r2", nil); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("trigger of unknown host: %v", err)
+	}
+}
+
+func TestSchedulerRerun(t *testing.T) {
+	s, clock, rec := newTestScheduler(t, t0, config.HostResolved{Name: "r1", Schedule: "0 0 1 1 *"})
+	rec.release = make(chan struct{})
+	pollAt(s, clock, t0)
+
+	first := make(chan Result, 1)
+	second := make(chan Result, 2)
+	if err := s.Trigger("r1", func(r Result) { first <- r }); err != nil {
+		t.Fatal(err)
+	}
+	// Both triggers during the run share the single rerun that follows it.
+	for i := 0; i < 2; i++ {
+		if err := s.Trigger("r1", func(r Result) { second <- r }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st, _ := s.State("r1"); !st.Running {
+		t.Fatal("host not running after trigger")
+	}
+
+	rec.release <- struct{}{}
+	<-first
+	if len(second) != 0 {
+		t.Fatal("rerun waiters notified by the first run")
+	}
+	rec.release <- struct{}{}
+	<-second
+	<-second
+	s.wg.Wait()
+	if got := rec.count("r1"); got != 2 {
+		t.Fatalf("%d runs, want the triggered run and one rerun", got)
+	}
+	if st, _ := s.State("r1"); st.Running {
+		t.Error("host still running")
+	}
+}
+
+func TestSchedulerHostChanges(t *testing.T) {
+	hosts := []config.HostResolved{{Name: "r1", Interval: time.Minute}, {Name: "r2", Interval: time.Minute}}
+	clock := &fakeClock{now: t0}
+	rec := &recorder{runs: map[string]int{}}
+	var mu sync.Mutex
+	s := New(func() []config.HostResolved {
+		mu.Lock()
+		defer mu.Unlock()
+		return hosts
+	}, rec.job, 2)
+	s.now = clock.Now
+	pollAt(s, clock, t0)
+
+	// r1 changes schedule and keeps its status, pause included; r2 is
+	// removed.
+	if err := s.Pause("r1"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	hosts = []config.HostResolved{{Name: "r1", Interval: 10 * time.Minute}}
+	mu.Unlock()
+	pollAt(s, clock, t0.Add(30*time.Second))
+
+	states := s.States()
+	if len(states) != 1 || states[0].Name != "r1" {
+		t.Fatalf("states %+v, want r1 only", states)
+	}
+	if st := states[0]; !st.Paused || st.LastSuccess == nil || !st.LastSuccess.Equal(t0) {
+		t.Errorf("r1 lost its status: %+v", st)
+	}
+	if rec.count("r1") != 1 {
+		t.Errorf("paused r1 ran %d times, want 1", rec.count("r1"))
+	}
+
+	if err := s.Resume("r1"); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := s.State("r1")
+	if want := t0.Add(30*time.Second + 10*time.Minute); st.NextRun == nil || !st.NextRun.Equal(want) {
+		t.Errorf("next run %v, want the new interval from the change at %s", st.NextRun, want)
+	}
+}
@@ -0,0 +1,394 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+// DefaultPatterns match the message each vendor logs after a config commit.
+var DefaultPatterns = map[string][]string{
+	"cisco_xr":      {`%MGBL-CONFIG-6-DB_COMMIT`},
+	"cisco_ios":     {`%SYS-5-CONFIG_I`},
+	"cisco_nxos":    {`%VSHD-5-VSHD_SYSLOG_CONFIG_I`},
+	"arista_eos":    {`%SYS-5-CONFIG_I`, `%SYS-5-CONFIG_SESSION_COMMIT_SUCCESS`},
+	"juniper_junos": {`UI_COMMIT_COMPLETED`},
+	"nokia_srlinux": {`sr_mgmt_server.*[Cc]ommit.*(completed|succeeded)`},
+}
+
+// maxMessage caps a single syslog message; longer ones are truncated.
+const maxMessage = 64 * 1024
+
+const (
+	// refreshEvery is how often the host list is checked for changes;
+	// host names are resolved again when it changes and every resolveEvery.
+	refreshEvery = time.Second
+	resolveEvery = 5 * time.Minute
+	// resolveTimeout bounds the lookup of one host name.
+	resolveTimeout = 2 * time.Second
+)
+
+type pattern struct {
+	vendor string
+	re     *regexp.Regexp
+}
+
+// Listener receives syslog over UDP and TCP and triggers a collection of the
+// sending host when a message matches a commit pattern. Matches for a host
+// are batched: the collection runs the debounce period after the first
+// commit, covering any further commits logged meanwhile. Sender IPs are
+// mapped to hosts through a table rebuilt, names resolved, whenever the
+// host list changes, so reading messages never waits for DNS.
+type Listener struct {
+	cfg      config.SyslogConfig
+	patterns []pattern
+	hosts    func() []config.Host
+	trigger  func(name string) error
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	// ips maps each host's address, resolved when it is a name, to the
+	// host name.
+	ips map[string]string
+}
+
+func New(cfg config.SyslogConfig, hosts func() []config.Host, trigger func(name string) error) (*Listener, error) {
+	merged := map[string][]string{}
+	for vendor, exprs := range DefaultPatterns {
+		merged[vendor] = exprs
+	}
+	for vendor, exprs := range cfg.Patterns {
+		merged[vendor] = exprs
+	}
+
+	vendors := make([]string, 0, len(merged))
+	for vendor := range merged {
+		vendors = append(vendors, vendor)
+	}
+	sort.Strings(vendors)
+
+	l := &Listener{cfg: cfg, hosts: hosts, trigger: trigger, timers: map[string]*time.Timer{}, ips: map[string]string{}}
+	for _, vendor := range vendors {
+		for _, expr := range merged[vendor] {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("syslog pattern %s %q: %w", vendor, expr, err)
+			}
+			l.patterns = append(l.patterns, pattern{vendor: vendor, re: re})
+		}
+	}
+	if len(l.patterns) == 0 {
+		return nil, errors.New("syslog: no commit patterns configured")
+	}
+	return l, nil
+}
+
+// Run listens until ctx is done. It fails only if a listener cannot be
+// opened; both are opened before either serves, so a failure leaves none
+// running.
+func (l *Listener) Run(ctx context.Context) error {
+	var (
+		conn net.PacketConn
+		ln   net.Listener
+		err  error
+	)
+	if l.cfg.UDP != "" {
+		conn, err = net.ListenPacket("udp", l.cfg.UDP)
+		if err != nil {
+			return fmt.Errorf("syslog udp: %w", err)
+		}
+	}
+	if l.cfg.TCP != "" {
+		ln, err = net.Listen("tcp", l.cfg.TCP)
+		if err != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return fmt.Errorf("syslog tcp: %w", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.refreshHosts(ctx)
+	}()
+	if conn != nil {
+		log.Printf("syslog listening on udp %s", l.cfg.UDP)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveUDP(ctx, conn)
+		}()
+	}
+	if ln != nil {
+		log.Printf("syslog listening on tcp %s", l.cfg.TCP)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveTCP(ctx, ln)
+		}()
+	}
+	wg.Wait()
+
+	l.mu.Lock()
+	for _, t := range l.timers {
+		t.Stop()
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *Listener) serveUDP(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("syslog udp: %v", err)
+			}
+			return
+		}
+		l.handle(sourceIP(addr), buf[:n])
+	}
+}
+
+func (l *Listener) serveTCP(ctx context.Context, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("syslog tcp: %v", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+			l.readStream(ctx, sourceIP(conn.RemoteAddr()), conn)
+		}()
+	}
+}
+
+// readStream handles both RFC 6587 framings: octet counting ("<len> <msg>")
+// and newline-terminated messages.
+func (l *Listener) readStream(ctx context.Context, ip string, r io.Reader) {
+	br := bufio.NewReaderSize(r, maxMessage)
+	for {
+		first, err := br.Peek(1)
+		if err != nil {
+			return
+		}
+		var msg []byte
+		if first[0] >= '1' && first[0] <= '9' {
+			msg, err = readOctetCounted(br)
+		} else {
+			msg, err = br.ReadSlice('\n')
+			if errors.Is(err, bufio.ErrBufferFull) {
+				err = nil
+			}
+		}
+		if len(msg) > 0 {
+			l.handle(ip, msg)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Printf("syslog tcp %s: %v", ip, err)
+			}
+			return
+		}
+	}
+}
+
+func readOctetCounted(br *bufio.Reader) ([]byte, error) {
+	raw, err := br.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(raw[:len(raw)-1])
+	if err != nil || size <= 0 || size > maxMessage {
+		return nil, fmt.Errorf("invalid frame length %q", raw)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(br, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (l *Listener) handle(ip string, msg []byte) {
+	vendor, ok := l.match(msg)
+	if !ok {
+		return
+	}
+	name, ok := l.lookup(ip)
+	if !ok {
+		log.Printf("syslog: %s commit from %s matches no host", vendor, ip)
+		return
+	}
+	l.schedule(vendor, name, ip)
+}
+
+func (l *Listener) match(msg []byte) (string, bool) {
+	for _, p := range l.patterns {
+		if p.re.Match(msg) {
+			return p.vendor, true
+		}
+	}
+	return "", false
+}
+
+// lookup maps a sender IP to a host: the configured sources first, then the
+// table of host addresses.
+func (l *Listener) lookup(ip string) (string, bool) {
+	if name, ok := l.cfg.Sources[ip]; ok {
+		return name, true
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	name, ok := l.ips[ip]
+	return name, ok
+}
+
+// refreshHosts rebuilds the address table when the host list changes, and
+// every resolveEvery so changed DNS records are picked up, until ctx is
+// done.
+func (l *Listener) refreshHosts(ctx context.Context) {
+	ticker := time.NewTicker(refreshEvery)
+	defer ticker.Stop()
+
+	var (
+		last     []config.Host
+		resolved time.Time
+	)
+	for {
+		hosts := l.hosts()
+		changed := !slices.EqualFunc(hosts, last, func(a, b config.Host) bool {
+			return a.Name == b.Name && a.Address == b.Address
+		})
+		if changed || time.Since(resolved) >= resolveEvery {
+			ips := resolveHosts(ctx, hosts)
+			if ctx.Err() != nil {
+				return
+			}
+			l.mu.Lock()
+			l.ips = ips
+			l.mu.Unlock()
+			last, resolved = hosts, time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveHosts maps the address of every host to its name. Addresses that
+// are names are resolved; one that does not resolve is left out until the
+// next refresh. The first host with an address wins.
+func resolveHosts(ctx context.Context, hosts []config.Host) map[string]string {
+	ips := make(map[string]string, len(hosts))
+	add := func(addr, name string) {
+		if ip := net.ParseIP(addr); ip != nil {
+			if _, ok := ips[ip.String()]; !ok {
+				ips[ip.String()] = name
+			}
+		}
+	}
+
+	var names []config.Host
+	for _, host := range hosts {
+		addr := hostPart(host.Address)
+		if net.ParseIP(addr) == nil {
+			names = append(names, host)
+			continue
+		}
+		add(addr, host.Name)
+	}
+	for _, host := range names {
+		lookupCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(lookupCtx, hostPart(host.Address))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ips
+			}
+			log.Printf("syslog: resolve %s (%s): %v", host.Name, host.Address, err)
+			continue
+		}
+		for _, addr := range addrs {
+			add(addr, host.Name)
+		}
+	}
+	return ips
+}
+
+// schedule collects the host the debounce period after its first commit.
+// Commits while a collection is pending are covered by it.
+func (l *Listener) schedule(vendor, name, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.timers[name]; ok {
+		log.Printf("syslog: %s commit on %s (%s); collection already pending", vendor, name, ip)
+		return
+	}
+	log.Printf("syslog: %s commit on %s (%s); collecting in %s", vendor, name, ip, l.cfg.Debounce)
+	l.timers[name] = time.AfterFunc(l.cfg.Debounce, func() {
+		l.mu.Lock()
+		delete(l.timers, name)
+		l.mu.Unlock()
+		if err := l.trigger(name); err != nil {
+			log.Printf("syslog: trigger %s: %v", name, err)
+		}
+	})
+}
+
+func hostPart(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func sourceIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	default:
+		return hostPart(addr.String())
+	}
+}
@@ -0,0 +1,66 @@
+package syslog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jalapeno/config-pub/internal/config"
+)
+
+func TestResolveHosts(t *testing.T) {
+	ips := resolveHosts(context.Background(), []config.Host{
+		{Name: "r1", Address: "10.0.0.1:57400"},
+		{Name: "r2", Address: "[2001:db8::2]:830"},
+		{Name: "r3", Address: "localhost"},
+		{Name: "dup", Address: "10.0.0.1"},
+	})
+	for ip, want := range map[string]string{"10.0.0.1": "r1", "2001:db8::2": "r2", "127.0.0.1": "r3"} {
+		if ips[ip] != want {
+			t.Errorf("%s maps to %q, want %q (table %v)", ip, ips[ip], want, ips)
+		}
+	}
+}
+
+func TestListenerTrigger(t *testing.T) {
+	const debounce = 100 * time.Millisecond
+	var (
+		mu        sync.Mutex
+		triggered []time.Time
+	)
+	l, err := New(config.SyslogConfig{Debounce: debounce, Sources: map[string]string{"192.0.2.9": "r1"}},
+		func() []config.Host { return nil },
+		func(name string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			triggered = append(triggered, time.Now())
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.ips = map[string]string{"10.0.0.1": "r1"}
+
+	// Commits every third of the debounce period: the first collection
+	// still runs one period after the first commit.
+	start := time.Now()
+	commit := []byte("<189>RP/0/RP0/CPU0:r1: config[65913]: %MGBL-CONFIG-6-DB_COMMIT : Configuration committed")
+	for i := 0; i < 5; i++ {
+		l.handle("::ffff:10.0.0.1", commit)
+		time.Sleep(debounce / 3)
+	}
+	l.handle("192.0.2.9", []byte("%SYS-5-CONFIG_I: Configured from console"))
+	l.handle("10.0.0.1", []byte("%LINK-3-UPDOWN: Interface Gi0/0, changed state to up"))
+	l.handle("10.0.0.2", commit)
+	time.Sleep(2 * debounce)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(triggered) != 2 {
+		t.Fatalf("%d collections, want 2", len(triggered))
+	}
+	if first := triggered[0].Sub(start); first < debounce || first > 2*debounce {
+		t.Errorf("first collection %s after the first commit, want about %s", first, debounce)
+	}
+}